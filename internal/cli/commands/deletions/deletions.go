@@ -0,0 +1,119 @@
+package deletions
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/guard"
+	"github.com/urfave/cli/v3"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:   "deletions",
+		Usage:  "list deletions paused by the deletion guard of running sync processes.",
+		Action: list,
+		Commands: []*cli.Command{
+			{
+				Name:      "approve",
+				Usage:     "delete the paused entries on the remote",
+				ArgsUsage: "[id]",
+				Action:    resolve(guard.DecisionApprove),
+			},
+			{
+				Name:      "discard",
+				Usage:     "keep the paused entries on the remote",
+				ArgsUsage: "[id]",
+				Action:    resolve(guard.DecisionDiscard),
+			},
+		},
+	}
+}
+
+func list(_ context.Context, cmd *cli.Command) error {
+	control, err := newControl()
+	if err != nil {
+		return err
+	}
+
+	requests, err := control.List()
+	if err != nil {
+		return cli.Exit(err.Error(), codes.InternalError)
+	}
+
+	w := cmd.Root().Writer
+	if len(requests) == 0 {
+		if _, prErr := fmt.Fprintln(w, "No deletions are waiting for confirmation"); prErr != nil {
+			return cli.Exit(prErr.Error(), codes.OutputError)
+		}
+		return nil
+	}
+
+	for _, req := range requests {
+		_, prErr := fmt.Fprintf(
+			w,
+			"%s  pid %d  %s  %d removals in %s\n  %s\n",
+			req.ID,
+			req.PID,
+			req.PausedAt.Format(time.DateTime),
+			req.Removals,
+			req.Source,
+			strings.Join(req.Paths, "\n  "),
+		)
+		if prErr != nil {
+			return cli.Exit(prErr.Error(), codes.OutputError)
+		}
+	}
+
+	return nil
+}
+
+// resolve records the decision for the request passed as the argument, or
+// for the only pending one.
+func resolve(decision guard.Decision) cli.ActionFunc {
+	return func(_ context.Context, cmd *cli.Command) error {
+		control, err := newControl()
+		if err != nil {
+			return err
+		}
+
+		id := cmd.Args().First()
+		if id == "" {
+			requests, listErr := control.List()
+			if listErr != nil {
+				return cli.Exit(listErr.Error(), codes.InternalError)
+			}
+
+			switch len(requests) {
+			case 0:
+				return cli.Exit("no deletions are waiting for confirmation", codes.ParamsError)
+			case 1:
+				id = requests[0].ID
+			default:
+				return cli.Exit(guard.ErrAmbiguousRequest.Error(), codes.ParamsError)
+			}
+		}
+
+		if resErr := control.Resolve(id, decision); resErr != nil {
+			return cli.Exit(resErr.Error(), codes.ParamsError)
+		}
+
+		if _, prErr := fmt.Fprintf(cmd.Root().Writer, "Deletions of %s: %s\n", id, decision); prErr != nil {
+			return cli.Exit(prErr.Error(), codes.OutputError)
+		}
+
+		return nil
+	}
+}
+
+func newControl() (*guard.Control, error) {
+	dir, err := guard.DefaultDir()
+	if err != nil {
+		return nil, cli.Exit(err.Error(), codes.InternalError)
+	}
+
+	return guard.NewControl(dir), nil
+}
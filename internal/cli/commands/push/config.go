@@ -0,0 +1,85 @@
+package push
+
+import (
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/cli/flags"
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/syncer"
+	"github.com/urfave/cli/v3"
+)
+
+type config struct {
+	Mappings    []flags.Mapping
+	IgnoreFiles []string
+	DryRun      bool
+	Compare     syncer.CompareStrategy
+	Delete      bool
+
+	Concurrency int
+
+	TrashDir       string
+	TrashRetention time.Duration
+
+	Client client.Options
+}
+
+func (c config) validate() error {
+	if len(c.Mappings) == 0 {
+		return cli.Exit("source directory is required", codes.ParamsError)
+	}
+
+	for _, m := range c.Mappings {
+		if len(m.Dests) == 0 {
+			return cli.Exit("destination server is required", codes.ParamsError)
+		}
+	}
+
+	if c.Concurrency < 1 {
+		return cli.Exit("concurrency must be at least 1", codes.ParamsError)
+	}
+
+	if c.TrashRetention < 0 {
+		return cli.Exit("trash retention must not be negative", codes.ParamsError)
+	}
+
+	return nil
+}
+
+func parseConfig(cmd *cli.Command) (config, error) {
+	cfg := config{
+		Mappings:    nil,
+		IgnoreFiles: flags.IgnoreFiles(cmd),
+		DryRun:      cmd.Bool("dry-run"),
+		Compare:     syncer.CompareSizeMtime,
+		Delete:      cmd.Bool("delete"),
+
+		Concurrency: cmd.Int("concurrency"),
+
+		TrashDir:       "",
+		TrashRetention: cmd.Duration("trash-retention"),
+
+		Client: flags.ClientOptions(cmd),
+	}
+
+	mappings, err := flags.Mappings(cmd)
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	cfg.Mappings = mappings
+
+	trashDir, err := flags.TrashDir(cmd)
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	cfg.TrashDir = trashDir
+
+	compare, err := syncer.ParseCompareStrategy(cmd.String("compare"))
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	cfg.Compare = compare
+
+	return cfg, cfg.validate()
+}
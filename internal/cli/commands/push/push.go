@@ -0,0 +1,268 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/cli/flags"
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/exclude"
+	"github.com/capcom6/sftp-sync/internal/syncer"
+	logger "github.com/go-core-fx/cli-logger"
+	"github.com/urfave/cli/v3"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "push",
+		Usage: "sync a local folder with a remote server once and exit.",
+		Arguments: []cli.Argument{
+			flags.Source("local directory to sync"),
+		},
+		Flags: append(flags.Sync(),
+			&cli.BoolFlag{
+				Name:  "delete",
+				Usage: "delete remote entries missing in the source tree",
+			},
+		),
+		ArgsUsage: "[source]",
+		Before:    flags.Before,
+		Action:    Action,
+	}
+}
+
+func Action(ctx context.Context, cmd *cli.Command) error {
+	log := logger.GetLogger(ctx)
+	if log == nil {
+		return cli.Exit("failed to retrieve logger", codes.InternalError)
+	}
+
+	operationID := logger.GenerateOperationID("push")
+	log = log.WithContext("push-cmd", operationID)
+
+	log.Info(ctx, "Push command initiated")
+
+	cfg, err := parseConfig(cmd)
+	if err != nil {
+		log.Error(ctx, "Failed to parse config", err)
+		return cli.Exit(err.Error(), codes.ParamsError)
+	}
+
+	var results []result
+	for _, m := range cfg.Mappings {
+		mLog := log
+		if len(cfg.Mappings) > 1 {
+			mLog = log.WithContext("push-cmd", operationID, logger.Fields{"source": m.Source})
+		}
+
+		excludeMatcher, exErr := exclude.New(m.Excludes, m.Source)
+		if exErr != nil {
+			mLog.Error(ctx, "Failed to build exclude matcher", exErr)
+			return cli.Exit(exErr.Error(), codes.ParamsError)
+		}
+		if exErr = excludeMatcher.Include(m.Includes...); exErr != nil {
+			mLog.Error(ctx, "Failed to build include rules", exErr)
+			return cli.Exit(exErr.Error(), codes.ParamsError)
+		}
+		if len(cfg.IgnoreFiles) > 0 {
+			if exErr = excludeMatcher.LoadIgnoreFiles(cfg.IgnoreFiles...); exErr != nil {
+				mLog.Error(ctx, "Failed to load ignore files", exErr)
+				return cli.Exit(exErr.Error(), codes.ParamsError)
+			}
+		}
+
+		// mirrors are pushed in parallel, so a slow one doesn't hold the others
+		mResults := make([]result, len(m.Dests))
+		var wg sync.WaitGroup
+		for i, dest := range m.Dests {
+			dLog := mLog
+			if len(m.Dests) > 1 {
+				dLog = mLog.WithContext("push-cmd", operationID, logger.Fields{"dest": client.Redact(dest)})
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				mResults[i] = push(ctx, m.Source, dest, excludeMatcher, cfg, dLog)
+			}()
+		}
+		wg.Wait()
+
+		results = append(results, mResults...)
+	}
+
+	if prErr := printResults(cmd, results); prErr != nil {
+		return cli.Exit(prErr.Error(), codes.OutputError)
+	}
+
+	if ctx.Err() != nil {
+		return cli.Exit("push interrupted", codes.InternalError)
+	}
+
+	var outOfDate, failed int
+	for _, r := range results {
+		if r.err != nil || r.stats.Failed > 0 {
+			outOfDate++
+		}
+		failed += r.stats.Failed
+	}
+
+	switch {
+	case len(results) > 1 && outOfDate > 0:
+		return cli.Exit(
+			fmt.Sprintf("%d of %d destinations are out of date", outOfDate, len(results)),
+			codes.ClientError,
+		)
+	case results[0].err != nil:
+		return cli.Exit(results[0].err.Error(), codes.ClientError)
+	case failed > 0:
+		return cli.Exit(fmt.Sprintf("%d entries failed to sync", failed), codes.ClientError)
+	}
+
+	log.Info(ctx, "Push command completed")
+	return nil
+}
+
+// result is the outcome of the push to a single destination.
+type result struct {
+	source string
+	dest   string
+	stats  syncer.Stats
+	err    error
+}
+
+// push reconciles the destination with the source tree.
+func push(
+	ctx context.Context,
+	source, dest string,
+	excludeMatcher *exclude.Matcher,
+	cfg config,
+	log logger.Logger,
+) result {
+	res := result{
+		source: source,
+		dest:   client.Redact(dest),
+		stats:  syncer.Stats{},
+		err:    nil,
+	}
+
+	// every worker and the walker use their own connections
+	syncers := make([]*syncer.Syncer, 0, cfg.Concurrency+1)
+	for range cfg.Concurrency + 1 {
+		remote, clErr := client.New(dest, cfg.Client, log)
+		if clErr != nil {
+			log.Error(ctx, "Failed to create remote client", clErr)
+			res.err = clErr
+			return res
+		}
+		syncers = append(
+			syncers,
+			syncer.New(source, remote, excludeMatcher, syncer.Options{Compare: cfg.Compare, TrashDir: cfg.TrashDir}, log),
+		)
+	}
+
+	walker := syncers[0]
+	pool := syncer.NewPool(syncers[1:], log)
+
+	var wg sync.WaitGroup
+	poolCtx, stopPool := context.WithCancel(ctx)
+	pool.Start(poolCtx, &wg)
+
+	res.stats, res.err = walker.Reconcile(ctx, syncer.ReconcileOptions{
+		Delete: cfg.Delete,
+		DryRun: cfg.DryRun,
+		Pool:   pool,
+
+		OnFailure: nil,
+		// nothing is uploaded before the pass
+		RemoveTempFiles: true,
+		OnRemoval:       nil,
+	})
+
+	stopPool()
+	wg.Wait()
+
+	if res.err != nil {
+		log.Error(ctx, "Failed to push", res.err)
+		return res
+	}
+
+	if !cfg.DryRun {
+		if _, err := walker.PurgeTrash(ctx, cfg.TrashRetention); err != nil {
+			// the destination is up to date anyway
+			log.Warn(ctx, "Failed to purge trash", logger.Fields{"error": err})
+		}
+	}
+
+	return res
+}
+
+// printResults prints the summary of every destination. When there are
+// several, each one gets a header and the out of date ones are listed last.
+func printResults(cmd *cli.Command, results []result) error {
+	w := cmd.Root().Writer
+	if len(results) == 1 {
+		if results[0].err != nil {
+			return nil
+		}
+		return printSummary(cmd, results[0].stats)
+	}
+
+	var outOfDate []string
+	for i, r := range results {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return fmt.Errorf("failed to print summary: %w", err)
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s -> %s\n", r.source, r.dest); err != nil {
+			return fmt.Errorf("failed to print summary: %w", err)
+		}
+
+		if r.err != nil || r.stats.Failed > 0 {
+			outOfDate = append(outOfDate, r.dest)
+		}
+
+		if r.err != nil {
+			if _, err := fmt.Fprintf(w, "Error:      %s\n", r.err); err != nil {
+				return fmt.Errorf("failed to print summary: %w", err)
+			}
+			continue
+		}
+		if err := printSummary(cmd, r.stats); err != nil {
+			return err
+		}
+	}
+
+	if len(outOfDate) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "\nOut of date:\n  %s\n", strings.Join(outOfDate, "\n  ")); err != nil {
+		return fmt.Errorf("failed to print summary: %w", err)
+	}
+
+	return nil
+}
+
+func printSummary(cmd *cli.Command, stats syncer.Stats) error {
+	_, err := fmt.Fprintf(
+		cmd.Root().Writer,
+		"Uploaded:   %d\nCreated:    %d\nRemoved:    %d\nUp to date: %d\nFailed:     %d\nDuration:   %s\n",
+		stats.Uploaded,
+		stats.Created,
+		stats.Removed,
+		stats.UpToDate,
+		stats.Failed,
+		stats.Duration,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to print summary: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/queue"
+	"github.com/urfave/cli/v3"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:   "queue",
+		Usage:  "list paths which failed to sync and wait for a retry.",
+		Action: list,
+		Commands: []*cli.Command{
+			{
+				Name:      "clear",
+				Usage:     "drop the queues with the IDs, or all queues",
+				ArgsUsage: "[id...]",
+				Action:    clearQueues,
+			},
+		},
+	}
+}
+
+func list(_ context.Context, cmd *cli.Command) error {
+	dir, err := queue.DefaultDir()
+	if err != nil {
+		return cli.Exit(err.Error(), codes.InternalError)
+	}
+
+	summaries, err := queue.List(dir)
+	if err != nil {
+		return cli.Exit(err.Error(), codes.InternalError)
+	}
+
+	w := cmd.Root().Writer
+	if len(summaries) == 0 {
+		if _, prErr := fmt.Fprintln(w, "Retry queue is empty"); prErr != nil {
+			return cli.Exit(prErr.Error(), codes.OutputError)
+		}
+		return nil
+	}
+
+	for i, s := range summaries {
+		if i > 0 {
+			if _, prErr := fmt.Fprintln(w); prErr != nil {
+				return cli.Exit(prErr.Error(), codes.OutputError)
+			}
+		}
+		if _, prErr := fmt.Fprintf(w, "%s  %s -> %s\n", s.ID, s.Source, s.Dest); prErr != nil {
+			return cli.Exit(prErr.Error(), codes.OutputError)
+		}
+
+		for _, item := range s.Items {
+			_, prErr := fmt.Fprintf(
+				w,
+				"  %s  attempts %d, next %s\n    %s\n",
+				item.Path,
+				item.Attempts,
+				item.NextAttempt.Format(time.DateTime),
+				item.LastError,
+			)
+			if prErr != nil {
+				return cli.Exit(prErr.Error(), codes.OutputError)
+			}
+		}
+	}
+
+	return nil
+}
+
+func clearQueues(_ context.Context, cmd *cli.Command) error {
+	dir, err := queue.DefaultDir()
+	if err != nil {
+		return cli.Exit(err.Error(), codes.InternalError)
+	}
+
+	cleared, err := queue.Clear(dir, cmd.Args().Slice()...)
+	if err != nil {
+		return cli.Exit(err.Error(), codes.ParamsError)
+	}
+
+	if _, prErr := fmt.Fprintf(cmd.Root().Writer, "Cleared %d queues\n", cleared); prErr != nil {
+		return cli.Exit(prErr.Error(), codes.OutputError)
+	}
+
+	return nil
+}
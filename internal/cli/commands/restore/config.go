@@ -0,0 +1,60 @@
+package restore
+
+import (
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/cli/flags"
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/urfave/cli/v3"
+)
+
+type config struct {
+	Dest     string
+	TrashDir string
+	Snapshot string
+	Paths    []string
+
+	Client client.Options
+}
+
+func (c config) validate() error {
+	if c.Dest == "" {
+		return cli.Exit("destination server is required", codes.ParamsError)
+	}
+
+	if c.TrashDir == "" {
+		return cli.Exit("trash directory is required", codes.ParamsError)
+	}
+
+	if c.Snapshot != "" && len(c.Paths) == 0 {
+		return cli.Exit("paths to restore are required with --from", codes.ParamsError)
+	}
+
+	return nil
+}
+
+func parseConfig(cmd *cli.Command) (config, error) {
+	cfg := config{
+		Dest:     "",
+		TrashDir: "",
+		Snapshot: cmd.String("from"),
+		Paths:    cmd.Args().Slice(),
+
+		Client: flags.ClientOptions(cmd),
+	}
+
+	switch dests := cmd.StringSlice("dest"); len(dests) {
+	case 0:
+	case 1:
+		cfg.Dest = dests[0]
+	default:
+		return cfg, cli.Exit("exactly one destination is required", codes.ParamsError)
+	}
+
+	trashDir, err := flags.TrashDir(cmd)
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	cfg.TrashDir = trashDir
+
+	return cfg, cfg.validate()
+}
@@ -0,0 +1,112 @@
+package restore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/cli/flags"
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/syncer"
+	logger "github.com/go-core-fx/cli-logger"
+	"github.com/urfave/cli/v3"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "restore",
+		Usage: "list the remote trash or move entries from it back to their place.",
+		Flags: append(append(flags.Config(),
+			&cli.StringSliceFlag{
+				Name:  "dest",
+				Usage: "destination server URL (ftp://, ftps://, ftpes:// or sftp://)",
+			},
+			flags.Trash(),
+			&cli.StringFlag{
+				Name:  "from",
+				Usage: "snapshot of the trash to restore from, the latest one containing the path by default",
+			},
+		), flags.Client()...),
+		ArgsUsage: "[path...]",
+		Before:    flags.LoadConfig,
+		Action:    Action,
+	}
+}
+
+func Action(ctx context.Context, cmd *cli.Command) error {
+	log := logger.GetLogger(ctx)
+	if log == nil {
+		return cli.Exit("failed to retrieve logger", codes.InternalError)
+	}
+
+	operationID := logger.GenerateOperationID("restore")
+	log = log.WithContext("restore-cmd", operationID)
+
+	cfg, err := parseConfig(cmd)
+	if err != nil {
+		log.Error(ctx, "Failed to parse config", err)
+		return cli.Exit(err.Error(), codes.ParamsError)
+	}
+
+	remote, err := client.New(cfg.Dest, cfg.Client, log)
+	if err != nil {
+		log.Error(ctx, "Failed to create remote client", err)
+		return cli.Exit(err.Error(), codes.ClientError)
+	}
+
+	// the source tree is not involved, entries are moved on the remote only
+	s := syncer.New(".", remote, nil, syncer.Options{Compare: syncer.CompareNone, TrashDir: cfg.TrashDir}, log)
+
+	if len(cfg.Paths) == 0 {
+		return list(ctx, cmd, s)
+	}
+
+	failed := 0
+	for _, p := range cfg.Paths {
+		snapshot, rsErr := s.Restore(ctx, p, cfg.Snapshot)
+		if rsErr != nil {
+			log.Error(ctx, "Failed to restore", rsErr, logger.Fields{"path": p})
+			failed++
+			continue
+		}
+
+		if _, prErr := fmt.Fprintf(cmd.Root().Writer, "Restored %s from %s\n", p, snapshot); prErr != nil {
+			return cli.Exit(prErr.Error(), codes.OutputError)
+		}
+	}
+
+	if failed > 0 {
+		return cli.Exit(fmt.Sprintf("%d of %d paths failed to restore", failed, len(cfg.Paths)), codes.ClientError)
+	}
+
+	return nil
+}
+
+// list prints the entries of the trash, the latest snapshots first.
+func list(ctx context.Context, cmd *cli.Command, s *syncer.Syncer) error {
+	entries, err := s.ListTrash(ctx)
+	if err != nil {
+		return cli.Exit(err.Error(), codes.ClientError)
+	}
+
+	w := cmd.Root().Writer
+	if len(entries) == 0 {
+		if _, prErr := fmt.Fprintln(w, "Trash is empty"); prErr != nil {
+			return cli.Exit(prErr.Error(), codes.OutputError)
+		}
+		return nil
+	}
+
+	for _, e := range entries {
+		name := e.Path
+		if e.Type == client.EntryTypeDir {
+			name += "/"
+		}
+
+		if _, prErr := fmt.Fprintf(w, "%s  %10d  %s\n", e.Snapshot, e.Size, name); prErr != nil {
+			return cli.Exit(prErr.Error(), codes.OutputError)
+		}
+	}
+
+	return nil
+}
@@ -1,21 +1,62 @@
 package sync
 
-import "github.com/urfave/cli/v3"
+import (
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/cli/flags"
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/guard"
+	"github.com/capcom6/sftp-sync/internal/queue"
+	"github.com/capcom6/sftp-sync/internal/syncer"
+	"github.com/urfave/cli/v3"
+)
 
 type config struct {
-	Source   string
-	Dest     string
-	Excludes []string
-	DryRun   bool
+	Mappings    []flags.Mapping
+	IgnoreFiles []string
+	DryRun      bool
+	Compare     syncer.CompareStrategy
+
+	Concurrency int
+
+	TrashDir       string
+	TrashRetention time.Duration
+
+	SkipInitialSync bool
+	Delete          bool
+	Debounce        time.Duration
+
+	DeletionGuard  guard.Threshold
+	DeletionWindow time.Duration
+
+	// QueueDir keeps the retry queues of the destinations.
+	QueueDir string
+
+	Client client.Options
 }
 
 func (c config) validate() error {
-	if c.Source == "" {
-		return cli.Exit("source directory is required", 1)
+	if len(c.Mappings) == 0 {
+		return cli.Exit("source directory is required", codes.ParamsError)
 	}
 
-	if c.Dest == "" {
-		return cli.Exit("destination server is required", 1)
+	for _, m := range c.Mappings {
+		if len(m.Dests) == 0 {
+			return cli.Exit("destination server is required", codes.ParamsError)
+		}
+	}
+
+	if c.Concurrency < 1 {
+		return cli.Exit("concurrency must be at least 1", codes.ParamsError)
+	}
+
+	if c.DeletionGuard.Enabled() && c.DeletionWindow <= 0 {
+		return cli.Exit("deletion guard window must be positive", codes.ParamsError)
+	}
+
+	if c.TrashRetention < 0 {
+		return cli.Exit("trash retention must not be negative", codes.ParamsError)
 	}
 
 	return nil
@@ -23,16 +64,68 @@ func (c config) validate() error {
 
 func parseConfig(cmd *cli.Command) (config, error) {
 	cfg := config{
-		Source:   "",
-		Dest:     "",
-		Excludes: nil,
-		DryRun:   false,
+		Mappings:    nil,
+		IgnoreFiles: nil,
+		DryRun:      false,
+		Compare:     syncer.CompareSizeMtime,
+
+		Concurrency: 1,
+
+		TrashDir:       "",
+		TrashRetention: 0,
+
+		SkipInitialSync: false,
+		Delete:          false,
+		Debounce:        0,
+
+		DeletionGuard:  guard.Threshold{Count: 0, Percent: 0},
+		DeletionWindow: 0,
+
+		QueueDir: "",
+
+		Client: client.Options{},
 	}
 
-	cfg.Source = cmd.StringArg("source")
-	cfg.Dest = cmd.String("dest")
-	cfg.Excludes = cmd.StringSlice("exclude")
+	mappings, err := flags.Mappings(cmd)
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	cfg.Mappings = mappings
+
+	cfg.IgnoreFiles = flags.IgnoreFiles(cmd)
 	cfg.DryRun = cmd.Bool("dry-run")
+	cfg.Concurrency = cmd.Int("concurrency")
+	cfg.SkipInitialSync = cmd.Bool("skip-initial-sync")
+	cfg.Delete = cmd.Bool("delete")
+	cfg.Debounce = cmd.Duration("debounce")
+	cfg.DeletionWindow = cmd.Duration("deletion-guard-window")
+	cfg.TrashRetention = cmd.Duration("trash-retention")
+
+	cfg.Client = flags.ClientOptions(cmd)
+
+	queueDir, err := queue.DefaultDir()
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.InternalError)
+	}
+	cfg.QueueDir = queueDir
+
+	trashDir, err := flags.TrashDir(cmd)
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	cfg.TrashDir = trashDir
+
+	threshold, err := guard.ParseThreshold(cmd.String("deletion-guard"))
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	cfg.DeletionGuard = threshold
+
+	compare, err := syncer.ParseCompareStrategy(cmd.String("compare"))
+	if err != nil {
+		return cfg, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	cfg.Compare = compare
 
 	return cfg, cfg.validate()
 }
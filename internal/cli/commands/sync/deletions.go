@@ -0,0 +1,267 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/guard"
+	"github.com/capcom6/sftp-sync/internal/watcher"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+const (
+	// deletionSettle is how long the removals are collected after the guard
+	// is tripped before the confirmation is requested, so the request shows
+	// the whole burst.
+	deletionSettle = time.Second
+	// maxRequestPaths is the number of removed paths listed in the request.
+	maxRequestPaths = 20
+)
+
+// deletions holds back removals of a pipeline while the deletion guard is
+// tripped. It's used by the consumer goroutine of the pipeline only.
+type deletions struct {
+	guard     *guard.Guard
+	confirmer *guard.Confirmer
+
+	paused bool
+	// requested is set once the confirmation is requested
+	requested bool
+	// held are the removals waiting for the decision, in order
+	held []heldRemoval
+	// heldEntries is the number of entries the held removals cover
+	heldEntries int
+	// settle fires when the removals have settled after the guard tripped
+	settle    *time.Timer
+	decisions chan guard.Decision
+}
+
+// removal is a removed entry with the number of entries it covers.
+type removal struct {
+	event   watcher.Event
+	entries int
+}
+
+// reconciledRemovals are the extraneous entries a reconciliation found on
+// the destination.
+type reconciledRemovals struct {
+	target   *target
+	removals []removal
+}
+
+// heldRemoval is a removal waiting for the decision. The target is set for
+// an extraneous entry of a single destination, the removals of the watcher
+// go to all of them.
+type heldRemoval struct {
+	event  watcher.Event
+	target *target
+}
+
+func newDeletions(threshold guard.Threshold, window time.Duration, confirmer *guard.Confirmer) *deletions {
+	settle := time.NewTimer(deletionSettle)
+	settle.Stop()
+
+	return &deletions{
+		guard:     guard.New(threshold, window),
+		confirmer: confirmer,
+
+		paused:      false,
+		requested:   false,
+		held:        nil,
+		heldEntries: 0,
+		settle:      settle,
+		decisions:   make(chan guard.Decision, 1),
+	}
+}
+
+func removedEvent(source, relPath string) watcher.Event {
+	return watcher.Event{
+		AbsPath: filepath.Join(source, relPath),
+		RelPath: relPath,
+		Type:    watcher.EventRemoved,
+
+		OldAbsPath: "",
+		OldRelPath: "",
+	}
+}
+
+// holdRemoval keeps the removal back if the guard is tripped, other events
+// pass through. A removal counts with all the entries it covers, e.g. the
+// whole content of a removed directory.
+func (p *pipeline) holdRemoval(ctx context.Context, event watcher.Event, entries int, t *target) bool {
+	d := p.deletions
+	if event.Type != watcher.EventRemoved {
+		return false
+	}
+
+	if !d.paused {
+		if !d.guard.Record(time.Now(), entries) {
+			return false
+		}
+
+		d.paused = true
+		p.logger.Warn(ctx, "Too many removals, deletions are paused until confirmed, uploads continue", logger.Fields{
+			"threshold": p.cfg.DeletionGuard.String(),
+			"window":    p.cfg.DeletionWindow,
+		})
+	}
+
+	d.held = append(d.held, heldRemoval{event: event, target: t})
+	d.heldEntries += max(entries, 1)
+	if !d.requested {
+		d.settle.Reset(deletionSettle)
+	}
+
+	return true
+}
+
+// checkReconciled passes the extraneous entries found by a reconciliation
+// through the deletion guard.
+func (p *pipeline) checkReconciled(ctx context.Context, r reconciledRemovals) {
+	approved := make([]watcher.Event, 0, len(r.removals))
+	for _, rm := range r.removals {
+		if !p.holdRemoval(ctx, rm.event, rm.entries, r.target) {
+			approved = append(approved, rm.event)
+		}
+	}
+	r.target.approve(approved...)
+}
+
+// checkRemovals passes the extraneous entries to the deletion guard of the
+// pipeline, the approved ones come back via approve.
+func (t *target) checkRemovals(ctx context.Context, removals []removal) {
+	if len(removals) == 0 {
+		return
+	}
+
+	t.logger.Info(ctx, "Extraneous entries are checked by the deletion guard", logger.Fields{
+		"removals": len(removals),
+	})
+
+	select {
+	case t.reconciled <- reconciledRemovals{target: t, removals: removals}:
+	case <-ctx.Done():
+	}
+}
+
+// approve queues the removals let through by the deletion guard. They
+// bypass the backlog, so they are never skipped.
+func (t *target) approve(events ...watcher.Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	t.approved = append(t.approved, events...)
+	t.mu.Unlock()
+
+	select {
+	case t.removalsReady <- struct{}{}:
+	default:
+	}
+}
+
+// removeApproved submits the approved removals, or keeps them for later
+// while the destination is offline.
+func (t *target) removeApproved(cancel context.CancelFunc) {
+	t.mu.Lock()
+	approved := t.approved
+	t.approved = nil
+	t.mu.Unlock()
+
+	offline := t.isOffline()
+	for _, event := range approved {
+		if offline {
+			t.markDirty(event)
+			continue
+		}
+		t.submit(event, cancel)
+	}
+}
+
+// requestConfirmation asks to confirm the held removals once they settled.
+// The decision is delivered to the consumer goroutine via the channel.
+func (p *pipeline) requestConfirmation(ctx context.Context, wg *sync.WaitGroup) {
+	d := p.deletions
+	if !d.paused || d.requested {
+		return
+	}
+	d.requested = true
+
+	paths := make([]string, 0, min(len(d.held), maxRequestPaths))
+	for _, h := range d.held[:cap(paths)] {
+		paths = append(paths, h.event.RelPath)
+	}
+
+	req := guard.Request{
+		ID:       d.confirmer.NewID(),
+		PID:      os.Getpid(),
+		Source:   p.mapping.Source,
+		Removals: d.heldEntries,
+		PausedAt: time.Now(),
+		Paths:    paths,
+	}
+
+	p.logger.Warn(ctx, "Deletions are waiting for confirmation", logger.Fields{
+		"removals": req.Removals,
+		"request":  req.ID,
+		"confirm":  "sftp-sync deletions approve " + req.ID,
+		"discard":  "sftp-sync deletions discard " + req.ID,
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		decision, err := d.confirmer.Await(ctx, req)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Error(ctx, "Failed to request confirmation, deletions stay paused", err)
+			}
+			return
+		}
+
+		select {
+		case d.decisions <- decision:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// resume applies the decision to the held removals.
+func (p *pipeline) resume(ctx context.Context, decision guard.Decision) {
+	d := p.deletions
+	held, entries := d.held, d.heldEntries
+
+	d.paused = false
+	d.requested = false
+	d.held = nil
+	d.heldEntries = 0
+	d.settle.Stop()
+	d.guard.Reset()
+
+	if decision != guard.DecisionApprove {
+		p.logger.Warn(ctx, "Deletions discarded, the remote entries are kept", logger.Fields{
+			"removals": entries,
+		})
+		return
+	}
+
+	p.logger.Info(ctx, "Deletions approved", logger.Fields{
+		"removals": entries,
+	})
+	for _, h := range held {
+		if h.target != nil {
+			h.target.approve(h.event)
+			continue
+		}
+		p.forward(ctx, h.event)
+	}
+
+	if p.entries != nil {
+		d.guard.SetTotal(p.entries.total())
+	}
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/capcom6/sftp-sync/internal/exclude"
+	"github.com/capcom6/sftp-sync/internal/watcher"
+)
+
+// entries indexes the files and directories of the source tree which are not
+// excluded, so a removal can be weighted by the number of entries it covers:
+// removing a directory is reported as a single event. It's used by the
+// consumer goroutine of the pipeline only.
+type entries struct {
+	root    string
+	matcher *exclude.Matcher
+	tree    *entryNode
+}
+
+type entryNode struct {
+	children map[string]*entryNode
+	// size is the number of entries of the subtree, including the node
+	size int
+}
+
+// newEntries indexes the tree under root.
+func newEntries(root string, matcher *exclude.Matcher) *entries {
+	e := &entries{
+		root:    root,
+		matcher: matcher,
+		tree:    &entryNode{children: map[string]*entryNode{}, size: 1},
+	}
+	e.scan(root)
+
+	return e
+}
+
+// total returns the number of entries of the tree.
+func (e *entries) total() int {
+	return e.tree.size - 1
+}
+
+// update applies the event and returns the number of entries it removed,
+// which is at least one for a removal.
+func (e *entries) update(event watcher.Event) int {
+	switch event.Type {
+	case watcher.EventCreated, watcher.EventModified:
+		e.scan(event.AbsPath)
+	case watcher.EventRenamed:
+		e.remove(event.OldRelPath)
+		e.scan(event.AbsPath)
+	case watcher.EventRemoved:
+		return max(e.remove(event.RelPath), 1)
+	}
+
+	return 0
+}
+
+// scan adds the entry and, for a directory, everything inside.
+func (e *entries) scan(absPath string) {
+	_ = filepath.WalkDir(absPath, func(p string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return nil //nolint:nilerr // unreadable entries are not counted
+		}
+		if p == e.root {
+			return nil
+		}
+
+		if e.matcher != nil && e.matcher.Match(p) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if relPath, err := filepath.Rel(e.root, p); err == nil && !strings.HasPrefix(relPath, "..") {
+			e.add(relPath)
+		}
+		return nil
+	})
+}
+
+func (e *entries) add(relPath string) {
+	path := []*entryNode{e.tree}
+	for _, part := range strings.Split(filepath.ToSlash(relPath), "/") {
+		node := path[len(path)-1]
+		child, ok := node.children[part]
+		if !ok {
+			child = &entryNode{children: map[string]*entryNode{}, size: 0}
+			node.children[part] = child
+		}
+		path = append(path, child)
+
+		if !ok {
+			// the new entry is counted by itself and its ancestors
+			for _, n := range path {
+				n.size++
+			}
+		}
+	}
+}
+
+// remove drops the entry with everything inside and returns their number.
+func (e *entries) remove(relPath string) int {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+
+	path := make([]*entryNode, 0, len(parts))
+	node := e.tree
+	for _, part := range parts[:len(parts)-1] {
+		path = append(path, node)
+		if node = node.children[part]; node == nil {
+			return 0
+		}
+	}
+	path = append(path, node)
+
+	name := parts[len(parts)-1]
+	removed, ok := node.children[name]
+	if !ok {
+		return 0
+	}
+	delete(node.children, name)
+
+	for _, n := range path {
+		n.size -= removed.size
+	}
+
+	return removed.size
+}
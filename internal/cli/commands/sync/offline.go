@@ -0,0 +1,144 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/queue"
+	"github.com/capcom6/sftp-sync/internal/watcher"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+// probeInterval is how often an unreachable destination is probed.
+const probeInterval = 10 * time.Second
+
+// offline collects the changed paths of a destination while it's
+// unreachable. It's guarded by the mutex of the target.
+type offline struct {
+	active bool
+	since  time.Time
+	// lastErr is the error which made the destination unreachable
+	lastErr error
+	// order keeps the dirty paths in order of their first change, dirty maps
+	// them to the absolute paths. The state of a path at the time of the flush
+	// is synced, so changes of the same path coalesce.
+	order []string
+	dirty map[string]string
+}
+
+func newOffline() offline {
+	return offline{
+		active:  false,
+		since:   time.Time{},
+		lastErr: nil,
+		order:   nil,
+		dirty:   map[string]string{},
+	}
+}
+
+// goOffline switches the destination to the offline state unless it's
+// already there.
+func (t *target) goOffline(ctx context.Context, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.offline.lastErr = err
+	if t.offline.active {
+		return
+	}
+
+	t.offline.active = true
+	t.offline.since = time.Now()
+	t.logger.Warn(ctx, "Destination is unreachable, changes are queued until it's back", logger.Fields{
+		"error":          err.Error(),
+		"probe_interval": probeInterval,
+	})
+}
+
+func (t *target) isOffline() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.offline.active
+}
+
+// markDirty records the paths of the event to be synced once the destination
+// is back.
+func (t *target) markDirty(event watcher.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if event.Type == watcher.EventRenamed {
+		t.addDirty(event.OldRelPath, event.OldAbsPath)
+	}
+	t.addDirty(event.RelPath, event.AbsPath)
+}
+
+func (t *target) addDirty(relPath, absPath string) {
+	if _, ok := t.offline.dirty[relPath]; !ok {
+		t.offline.order = append(t.offline.order, relPath)
+	}
+	t.offline.dirty[relPath] = absPath
+}
+
+// probe checks an unreachable destination and flushes the dirty paths in one
+// batch once it's back.
+func (t *target) probe(ctx context.Context, cancel context.CancelFunc) {
+	if !t.isOffline() {
+		return
+	}
+
+	if err := t.control.Probe(ctx); err != nil {
+		t.logger.Debug(ctx, "Destination is still unreachable", logger.Fields{"error": err.Error()})
+		return
+	}
+
+	t.mu.Lock()
+	order, dirty := t.offline.order, t.offline.dirty
+	since := t.offline.since
+	t.offline = newOffline()
+	t.mu.Unlock()
+
+	t.logger.Info(ctx, "Destination is reachable again, flushing queued changes", logger.Fields{
+		"paths":       len(order),
+		"offline_for": time.Since(since).Round(time.Second),
+	})
+	for _, relPath := range order {
+		t.submit(watcher.Event{
+			AbsPath: dirty[relPath],
+			RelPath: relPath,
+			Type:    watcher.EventModified,
+
+			OldAbsPath: "",
+			OldRelPath: "",
+		}, cancel)
+	}
+}
+
+// saveDirty moves the dirty paths to the retry queue on shutdown, so the
+// next run syncs them.
+func (t *target) saveDirty(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.offline.active {
+		return
+	}
+
+	now := time.Now()
+	for _, relPath := range t.offline.order {
+		_, err := t.queue.Add(queue.Item{
+			Path:    relPath,
+			AbsPath: t.offline.dirty[relPath],
+
+			Attempts:    0,
+			LastError:   "",
+			FailedAt:    time.Time{},
+			NextAttempt: time.Time{},
+		}, t.offline.lastErr, now)
+		if err != nil {
+			t.logger.Error(ctx, "Failed to update retry queue", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package sync
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/cli/flags"
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/debounce"
+	"github.com/capcom6/sftp-sync/internal/exclude"
+	"github.com/capcom6/sftp-sync/internal/guard"
+	"github.com/capcom6/sftp-sync/internal/watcher"
+	logger "github.com/go-core-fx/cli-logger"
+	"github.com/urfave/cli/v3"
+)
+
+// pipeline watches the source directory of a mapping and syncs changes to
+// its destinations.
+type pipeline struct {
+	mapping flags.Mapping
+	cfg     config
+
+	logger logger.Logger
+
+	watcher *watcher.Watcher
+	matcher *exclude.Matcher
+	targets []*target
+
+	deletions *deletions
+	// entries weights the removals reported by the watcher, it's set while
+	// the deletion guard is enabled
+	entries *entries
+	// reconciled receives the extraneous entries found by reconciliations
+	// of the destinations
+	reconciled chan reconciledRemovals
+}
+
+func newPipeline(
+	ctx context.Context,
+	m flags.Mapping,
+	cfg config,
+	log logger.Logger,
+	operationID string,
+	confirmer *guard.Confirmer,
+) (*pipeline, error) {
+	excludeMatcher, err := exclude.New(m.Excludes, m.Source)
+	if err != nil {
+		log.Error(ctx, "Failed to build exclude matcher", err)
+		return nil, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	if err = excludeMatcher.Include(m.Includes...); err != nil {
+		log.Error(ctx, "Failed to build include rules", err)
+		return nil, cli.Exit(err.Error(), codes.ParamsError)
+	}
+	if len(cfg.IgnoreFiles) > 0 {
+		if err = excludeMatcher.LoadIgnoreFiles(cfg.IgnoreFiles...); err != nil {
+			log.Error(ctx, "Failed to load ignore files", err)
+			return nil, cli.Exit(err.Error(), codes.ParamsError)
+		}
+	}
+
+	// with the deletion guard, extraneous entries are removed only once
+	// they pass it
+	reconciled := make(chan reconciledRemovals)
+	var guarded chan<- reconciledRemovals
+	if cfg.Delete && cfg.DeletionGuard.Enabled() && !cfg.DryRun {
+		guarded = reconciled
+	}
+
+	targets := make([]*target, 0, len(m.Dests))
+	for _, dest := range m.Dests {
+		tLog := log
+		if len(m.Dests) > 1 {
+			tLog = log.WithContext("sync-cmd", operationID, logger.Fields{"dest": client.Redact(dest)})
+		}
+
+		t, tErr := newTarget(m.Source, dest, excludeMatcher, cfg, guarded, tLog)
+		if tErr != nil {
+			tLog.Error(ctx, "Failed to create remote client", tErr)
+			return nil, cli.Exit(tErr.Error(), codes.ClientError)
+		}
+		targets = append(targets, t)
+	}
+
+	return &pipeline{
+		mapping: m,
+		cfg:     cfg,
+
+		logger: log,
+
+		watcher: watcher.New(m.Source, excludeMatcher, log),
+		matcher: excludeMatcher,
+		targets: targets,
+
+		deletions:  newDeletions(cfg.DeletionGuard, cfg.DeletionWindow, confirmer),
+		entries:    nil,
+		reconciled: reconciled,
+	}, nil
+}
+
+// start runs the pipeline until ctx is done. Errors which can't be recovered
+// are reported to fail once every destination is stopped.
+func (p *pipeline) start(ctx context.Context, wg *sync.WaitGroup, fail func(error)) error {
+	events, err := p.watcher.Watch(ctx, wg)
+	if err != nil {
+		p.logger.Error(ctx, "Failed to start watcher", err)
+		return cli.Exit(err.Error(), codes.InternalError)
+	}
+
+	ch := debounce.New(p.cfg.Debounce, p.logger).Run(ctx, wg, events)
+
+	if p.cfg.DeletionGuard.Enabled() && !p.cfg.DryRun {
+		source, absErr := filepath.Abs(p.mapping.Source)
+		if absErr != nil {
+			return cli.Exit(absErr.Error(), codes.InternalError)
+		}
+		p.entries = newEntries(source, p.matcher)
+		p.deletions.guard.SetTotal(p.entries.total())
+	}
+
+	// the watcher is already running, so changes made during the initial
+	// sync are queued and processed afterwards
+	var stopped atomic.Int32
+	for _, t := range p.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// a broken destination doesn't stop the others
+			if runErr := t.run(ctx, wg); runErr != nil && int(stopped.Add(1)) == len(p.targets) {
+				fail(runErr)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case event, ok := <-ch:
+				if !ok {
+					p.logger.Warn(ctx, "watcher channel closed")
+					return
+				}
+				p.logger.Debug(ctx, "Event received", logger.Fields{"event": event})
+				if p.cfg.DryRun {
+					p.dryRunLog(ctx, event)
+					continue
+				}
+				removed := 0
+				if p.entries != nil {
+					removed = p.entries.update(event)
+				}
+				if p.holdRemoval(ctx, event, removed, nil) {
+					continue
+				}
+
+				p.forward(ctx, event)
+			case r := <-p.reconciled:
+				p.checkReconciled(ctx, r)
+			case <-p.deletions.settle.C:
+				p.requestConfirmation(ctx, wg)
+			case decision := <-p.deletions.decisions:
+				p.resume(ctx, decision)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (p *pipeline) forward(ctx context.Context, event watcher.Event) {
+	for _, t := range p.targets {
+		t.enqueue(ctx, event)
+	}
+}
+
+// report logs whether every destination is up to date.
+func (p *pipeline) report(ctx context.Context) {
+	if held := p.deletions.heldEntries; held > 0 {
+		p.logger.Warn(ctx, "Paused deletions were not confirmed, the remote entries are kept", logger.Fields{
+			"removals": held,
+		})
+	}
+
+	for _, t := range p.targets {
+		reason, fields := t.status()
+		if reason == "" {
+			p.logger.Info(ctx, "Destination is up to date", fields)
+			continue
+		}
+
+		fields["reason"] = reason
+		p.logger.Warn(ctx, "Destination is out of date", fields)
+	}
+}
+
+func (p *pipeline) dryRunLog(ctx context.Context, event watcher.Event) {
+	var action string
+	switch event.Type {
+	case watcher.EventCreated:
+		action = "create"
+	case watcher.EventModified:
+		action = "modify"
+	case watcher.EventRemoved:
+		action = "remove"
+	case watcher.EventRenamed:
+		p.logger.Info(ctx, "Would rename", logger.Fields{"path": event.RelPath, "from": event.OldRelPath})
+		return
+	default:
+		return
+	}
+
+	p.logger.Info(ctx, "Would "+action, logger.Fields{"path": event.RelPath})
+}
@@ -2,57 +2,66 @@ package sync
 
 import (
 	"context"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/capcom6/sftp-sync/internal/cli/codes"
-	"github.com/capcom6/sftp-sync/internal/client"
-	"github.com/capcom6/sftp-sync/internal/exclude"
-	"github.com/capcom6/sftp-sync/internal/syncer"
-	"github.com/capcom6/sftp-sync/internal/watcher"
+	"github.com/capcom6/sftp-sync/internal/cli/flags"
+	"github.com/capcom6/sftp-sync/internal/guard"
 	logger "github.com/go-core-fx/cli-logger"
 	"github.com/urfave/cli/v3"
 )
 
+const (
+	defaultDebounce       = 300 * time.Millisecond
+	defaultDeletionWindow = time.Minute
+)
+
 func Command() *cli.Command {
 	return &cli.Command{
 		Name:  "sync",
 		Usage: "watch a local folder for changes and sync them to a remote FTP server.",
 		Arguments: []cli.Argument{
-			&cli.StringArg{
-				Name:      "source",
-				UsageText: "local directory to watch for changes",
-				Config: cli.StringConfig{
-					TrimSpace: true,
-				},
-			},
-		},
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:     "dest",
-				Usage:    "destination FTP server URL",
-				Required: true,
-			},
-			&cli.StringSliceFlag{
-				Name:  "exclude",
-				Usage: "paths or glob patterns to exclude (supports *, **, ?)",
-			},
-			&cli.BoolFlag{
-				Name:  "dry-run",
-				Usage: "perform a dry run without actually syncing files",
-			},
+			flags.Source("local directory to watch for changes"),
 		},
+		Flags:     Flags(),
 		ArgsUsage: "[source]",
 		Before:    Before,
 		Action:    Action,
 	}
 }
 
-func Before(ctx context.Context, cmd *cli.Command) (context.Context, error) {
-	if cmd.Args().Len() != 1 {
-		return ctx, cli.Exit("exactly one argument is required", codes.ParamsError)
-	}
+// Flags returns the options of the sync command.
+func Flags() []cli.Flag {
+	return append(flags.Sync(),
+		&cli.BoolFlag{
+			Name:  "skip-initial-sync",
+			Usage: "don't reconcile the remote with the source tree before watching",
+		},
+		&cli.BoolFlag{
+			Name:  "delete",
+			Usage: "delete remote entries missing in the source tree during the initial sync",
+		},
+		&cli.DurationFlag{
+			Name:  "debounce",
+			Usage: "quiet period to collect and coalesce events before syncing, 0 to sync every event immediately",
+			Value: defaultDebounce,
+		},
+		&cli.StringFlag{
+			Name:  "deletion-guard",
+			Usage: "pause deletions until confirmed when more entries are removed within the window, e.g. 100 or 25%",
+		},
+		&cli.DurationFlag{
+			Name:  "deletion-guard-window",
+			Usage: "time window of the deletion guard",
+			Value: defaultDeletionWindow,
+		},
+	)
+}
 
-	return ctx, nil
+func Before(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	return flags.Before(ctx, cmd)
 }
 
 func Action(ctx context.Context, cmd *cli.Command) error {
@@ -72,74 +81,67 @@ func Action(ctx context.Context, cmd *cli.Command) error {
 		return cli.Exit(err.Error(), codes.ParamsError)
 	}
 
-	remote, err := client.New(cfg.Dest, log)
-	if err != nil {
-		log.Error(ctx, "Failed to create remote client", err)
-		return cli.Exit(err.Error(), codes.ClientError)
+	var confirmer *guard.Confirmer
+	if cfg.DeletionGuard.Enabled() && !cfg.DryRun {
+		controlDir, dirErr := guard.DefaultDir()
+		if dirErr != nil {
+			log.Error(ctx, "Failed to locate deletions control directory", dirErr)
+			return cli.Exit(dirErr.Error(), codes.InternalError)
+		}
+		confirmer = guard.NewConfirmer(guard.NewControl(controlDir), os.Stdin, cmd.Root().Writer)
 	}
 
-	excludeMatcher, err := exclude.New(cfg.Excludes, cfg.Source)
-	if err != nil {
-		log.Error(ctx, "Failed to build exclude matcher", err)
-		return cli.Exit(err.Error(), codes.ParamsError)
+	pipelines := make([]*pipeline, 0, len(cfg.Mappings))
+	for _, m := range cfg.Mappings {
+		plLog := log
+		if len(cfg.Mappings) > 1 {
+			plLog = log.WithContext("sync-cmd", operationID, logger.Fields{"source": m.Source})
+		}
+
+		p, plErr := newPipeline(ctx, m, cfg, plLog, operationID, confirmer)
+		if plErr != nil {
+			return plErr
+		}
+		pipelines = append(pipelines, p)
 	}
 
-	watcher := watcher.New(cfg.Source, excludeMatcher, log)
-	syncer := syncer.New(cfg.Source, remote, excludeMatcher, log)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	var wg sync.WaitGroup
-
-	ch, err := watcher.Watch(ctx, &wg)
-	if err != nil {
-		log.Error(ctx, "Failed to start watcher", err)
-		return cli.Exit(err.Error(), codes.InternalError)
+	var fatalErr error
+	var fatalOnce sync.Once
+	fail := func(err error) {
+		fatalOnce.Do(func() {
+			fatalErr = err
+			cancel()
+		})
 	}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		for {
-			select {
-			case event, ok := <-ch:
-				if !ok {
-					log.Warn(ctx, "watcher channel closed")
-					return
-				}
-				log.Debug(ctx, "Event received", logger.Fields{"event": event})
-				if cfg.DryRun {
-					dryRunLog(ctx, event)
-				} else if syncErr := syncer.Sync(ctx, event.AbsPath); syncErr != nil {
-					log.Error(ctx, "Failed to sync", syncErr)
-				}
-			case <-ctx.Done():
-				return
-			}
+	for _, p := range pipelines {
+		if startErr := p.start(ctx, &wg, fail); startErr != nil {
+			cancel()
+			wg.Wait()
+			return startErr
 		}
-	}()
+	}
 
-	log.Info(ctx, "Sync command started")
+	log.Info(ctx, "Sync command started", logger.Fields{
+		"mappings": len(pipelines),
+		"workers":  cfg.Concurrency,
+	})
 
 	wg.Wait()
 
-	log.Info(ctx, "Sync command completed")
-	return nil
-}
-
-func dryRunLog(ctx context.Context, event watcher.Event) {
-	log := logger.GetLogger(ctx)
+	for _, p := range pipelines {
+		p.report(ctx)
+	}
 
-	var action string
-	switch event.Type {
-	case watcher.EventCreated:
-		action = "create"
-	case watcher.EventModified:
-		action = "modify"
-	case watcher.EventRemoved:
-		action = "remove"
-	default:
-		return
+	// all goroutines are stopped, so it's safe to read without the once
+	if fatalErr != nil {
+		return cli.Exit(fatalErr.Error(), codes.ClientError)
 	}
 
-	log.Info(ctx, "Would "+action, logger.Fields{"path": event.RelPath})
+	log.Info(ctx, "Sync command completed")
+	return nil
 }
@@ -0,0 +1,230 @@
+package sync_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/cli/commands/sync"
+	"github.com/capcom6/sftp-sync/internal/client/clienttest"
+	"github.com/capcom6/sftp-sync/internal/guard"
+	logger "github.com/go-core-fx/cli-logger"
+	"github.com/urfave/cli/v3"
+)
+
+// waitFor polls the condition until it's met or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func readFile(path string) string {
+	data, _ := os.ReadFile(path)
+	return string(data)
+}
+
+// TestActionSyncsChanges runs the whole command against an FTP server: the
+// initial sync, the watch loop and the shutdown.
+//
+//nolint:paralleltest // the cache and config directories are set via the environment
+func TestActionSyncsChanges(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	server := clienttest.NewFTPServer(t)
+	source := t.TempDir()
+	remote := server.Root()
+
+	// only .syncignore is honoured by default
+	for name, content := range map[string]string{
+		"index.html":  "hello",
+		".gitignore":  "dist/\n",
+		".syncignore": "secret.txt\n",
+		"secret.txt":  "secret",
+		"dist/app.js": "app",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(source, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(source, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := sync.Command()
+	cmd.ExitErrHandler = func(context.Context, *cli.Command, error) {}
+
+	ctx, cancel := context.WithCancel(logger.WithLogger(t.Context(), logger.NewDefault()))
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run(ctx, []string{"sync", "--dest", server.URL(), "--debounce", "0", source})
+	}()
+
+	waitFor(t, "the initial sync", func() bool {
+		return readFile(filepath.Join(remote, "index.html")) == "hello" &&
+			readFile(filepath.Join(remote, "dist", "app.js")) == "app"
+	})
+
+	// the watcher is started right after the initial sync, so changes are
+	// repeated until they are picked up
+	waitFor(t, "a new file", func() bool {
+		_ = os.WriteFile(filepath.Join(source, "new.txt"), []byte("new"), 0o600)
+		return readFile(filepath.Join(remote, "new.txt")) == "new"
+	})
+
+	if err := os.Mkdir(filepath.Join(source, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "docs", "readme.md"), []byte("docs"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "a new directory", func() bool {
+		return readFile(filepath.Join(remote, "docs", "readme.md")) == "docs"
+	})
+
+	if err := os.Remove(filepath.Join(source, "index.html")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "a removal", func() bool {
+		return !exists(filepath.Join(remote, "index.html"))
+	})
+	if exists(filepath.Join(remote, "secret.txt")) {
+		t.Fatal("secret.txt listed in .syncignore was uploaded")
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil && !errors.Is(err, context.Canceled) {
+			t.Fatalf("Action: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the command to stop")
+	}
+}
+
+// pendingRequest waits for a single confirmation request of the deletion
+// guard.
+func pendingRequest(t *testing.T, control *guard.Control) guard.Request {
+	t.Helper()
+
+	var requests []guard.Request
+	waitFor(t, "a confirmation request", func() bool {
+		requests, _ = control.List()
+		return len(requests) == 1
+	})
+
+	return requests[0]
+}
+
+// TestActionGuardsDeletions checks that the extraneous remote entries of the
+// initial sync and a removed directory are held until confirmed.
+//
+//nolint:paralleltest // the cache and config directories are set via the environment
+func TestActionGuardsDeletions(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	controlDir, err := guard.DefaultDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	control := guard.NewControl(controlDir)
+
+	server := clienttest.NewFTPServer(t)
+	source := t.TempDir()
+	remote := server.Root()
+
+	if wErr := os.WriteFile(filepath.Join(source, "index.html"), []byte("hello"), 0o600); wErr != nil {
+		t.Fatal(wErr)
+	}
+	// the source is missing a whole directory of the remote
+	if mkErr := os.MkdirAll(filepath.Join(remote, "old"), 0o755); mkErr != nil {
+		t.Fatal(mkErr)
+	}
+	for i := range 20 {
+		name := filepath.Join(remote, "old", fmt.Sprintf("%d.txt", i))
+		if wErr := os.WriteFile(name, []byte("old"), 0o600); wErr != nil {
+			t.Fatal(wErr)
+		}
+	}
+
+	cmd := sync.Command()
+	cmd.ExitErrHandler = func(context.Context, *cli.Command, error) {}
+
+	ctx, cancel := context.WithCancel(logger.WithLogger(t.Context(), logger.NewDefault()))
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run(ctx, []string{
+			"sync", "--dest", server.URL(), "--debounce", "100ms",
+			"--delete", "--deletion-guard", "10", source,
+		})
+	}()
+
+	req := pendingRequest(t, control)
+	if req.Removals != 21 || !exists(filepath.Join(remote, "old", "0.txt")) {
+		t.Fatalf("got %d removals, want the 21 entries of old to be held", req.Removals)
+	}
+	if resErr := control.Resolve(req.ID, guard.DecisionApprove); resErr != nil {
+		t.Fatal(resErr)
+	}
+	waitFor(t, "the approved removal", func() bool {
+		return !exists(filepath.Join(remote, "old"))
+	})
+
+	// a removed directory counts with its content
+	site := filepath.Join(source, "site")
+	if mkErr := os.Mkdir(site, 0o755); mkErr != nil {
+		t.Fatal(mkErr)
+	}
+	for i := range 15 {
+		if wErr := os.WriteFile(filepath.Join(site, fmt.Sprintf("%d.txt", i)), []byte("new"), 0o600); wErr != nil {
+			t.Fatal(wErr)
+		}
+	}
+	waitFor(t, "the new directory", func() bool {
+		return readFile(filepath.Join(remote, "site", "14.txt")) == "new"
+	})
+	if rmErr := os.RemoveAll(site); rmErr != nil {
+		t.Fatal(rmErr)
+	}
+
+	waitFor(t, "the previous request to be withdrawn", func() bool {
+		requests, _ := control.List()
+		return len(requests) == 0 || requests[0].ID != req.ID
+	})
+	pendingRequest(t, control)
+	if !exists(filepath.Join(remote, "site", "0.txt")) {
+		t.Fatal("the removed directory was deleted on the remote without confirmation")
+	}
+
+	cancel()
+	select {
+	case runErr := <-done:
+		if runErr != nil && !errors.Is(runErr, context.Canceled) {
+			t.Fatalf("Action: %v", runErr)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the command to stop")
+	}
+}
@@ -0,0 +1,432 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/exclude"
+	"github.com/capcom6/sftp-sync/internal/queue"
+	"github.com/capcom6/sftp-sync/internal/syncer"
+	"github.com/capcom6/sftp-sync/internal/watcher"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+// targetBacklog is the number of events buffered per destination. A
+// destination falling further behind skips events and is reconciled once it
+// catches up, so it never blocks the others.
+const targetBacklog = 1024
+
+// trashPurgeInterval is how often trash snapshots past the retention period
+// are purged while watching.
+const trashPurgeInterval = time.Hour
+
+// target syncs the events of a pipeline to one of its destinations.
+type target struct {
+	// source is the absolute path of the source directory
+	source string
+	dest   string
+	cfg    config
+
+	logger logger.Logger
+
+	// control walks the tree, probes the destination and purges the trash
+	// on its own connection, so it never shares one with a worker of the pool
+	control *syncer.Syncer
+	pool    *syncer.Pool
+	events  chan watcher.Event
+	// queue holds the paths which failed to sync until they are retried
+	// successfully, it survives restarts.
+	queue *queue.Queue
+	// reconciled passes the extraneous entries found by reconciliations to
+	// the deletion guard of the pipeline, they are removed at once if nil.
+	reconciled chan<- reconciledRemovals
+	// removalsReady signals removals let through by the deletion guard.
+	removalsReady chan struct{}
+
+	mu sync.Mutex
+	// overflow is set when events were skipped because of the full backlog.
+	overflow bool
+	// stopErr is the permanent error which stopped the destination.
+	stopErr error
+	// offline collects the changes while the destination is unreachable.
+	offline offline
+	// approved are the removals let through by the deletion guard.
+	approved []watcher.Event
+}
+
+func newTarget(
+	source, dest string,
+	matcher *exclude.Matcher,
+	cfg config,
+	reconciled chan<- reconciledRemovals,
+	log logger.Logger,
+) (*target, error) {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return nil, fmt.Errorf("filepath.Abs: %w", err)
+	}
+
+	retryQueue, err := queue.Open(cfg.QueueDir, absSource, dest, client.Redact(dest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open retry queue: %w", err)
+	}
+
+	// every worker and the control syncer use their own connections
+	syncers := make([]*syncer.Syncer, 0, cfg.Concurrency+1)
+	for range cfg.Concurrency + 1 {
+		remote, err := client.New(dest, cfg.Client, log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create remote client: %w", err)
+		}
+		syncers = append(
+			syncers,
+			syncer.New(source, remote, matcher, syncer.Options{Compare: cfg.Compare, TrashDir: cfg.TrashDir}, log),
+		)
+	}
+
+	return &target{
+		source: absSource,
+		dest:   client.Redact(dest),
+		cfg:    cfg,
+
+		logger: log,
+
+		control: syncers[0],
+		pool:    syncer.NewPool(syncers[1:], log),
+		events:  make(chan watcher.Event, targetBacklog),
+		queue:   retryQueue,
+
+		reconciled:    reconciled,
+		removalsReady: make(chan struct{}, 1),
+
+		mu:       sync.Mutex{},
+		overflow: false,
+		stopErr:  nil,
+		offline:  newOffline(),
+		approved: nil,
+	}, nil
+}
+
+// enqueue passes the event to the destination without blocking.
+func (t *target) enqueue(ctx context.Context, event watcher.Event) {
+	select {
+	case t.events <- event:
+	default:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if !t.overflow {
+			t.logger.Warn(ctx, "Destination is falling behind, it will be reconciled later")
+		}
+		t.overflow = true
+	}
+}
+
+// run performs the initial sync and syncs the events until ctx is done or
+// the destination is stopped by a permanent error, which is returned then.
+func (t *target) run(ctx context.Context, wg *sync.WaitGroup) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t.pool.Start(ctx, wg)
+
+	if !t.cfg.SkipInitialSync {
+		if err := t.reconcile(ctx, "Initial sync", true); err != nil {
+			return t.fail(ctx, "Failed to perform initial sync", err)
+		}
+	} else {
+		t.removeTempFiles(ctx)
+	}
+
+	t.purgeTrash(ctx)
+	purge := time.NewTicker(trashPurgeInterval)
+	defer purge.Stop()
+
+	// queued paths of the previous run are due at once
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+
+	probe := time.NewTicker(probeInterval)
+	defer probe.Stop()
+
+	for {
+		offline := t.isOffline()
+		if !offline && t.takeOverflow() {
+			// events were skipped, so only a full pass brings it up to date
+			// workers may still be uploading, so temporary files are kept
+			if err := t.reconcile(ctx, "Catch-up sync", false); err != nil {
+				return t.fail(ctx, "Failed to perform catch-up sync", err)
+			}
+		}
+
+		if next, ok := t.queue.Next(); ok && !t.cfg.DryRun && !offline {
+			retry.Reset(time.Until(next))
+		} else {
+			retry.Stop()
+		}
+
+		select {
+		case event := <-t.events:
+			if t.isOffline() {
+				t.markDirty(event)
+				continue
+			}
+			t.submit(event, cancel)
+		case <-t.removalsReady:
+			t.removeApproved(cancel)
+		case <-retry.C:
+			t.retry(ctx, cancel)
+		case <-probe.C:
+			t.probe(ctx, cancel)
+		case <-purge.C:
+			if !offline {
+				t.purgeTrash(ctx)
+			}
+		case <-ctx.Done():
+			t.saveDirty(context.WithoutCancel(ctx))
+			return t.stop(nil)
+		}
+	}
+}
+
+func (t *target) reconcile(ctx context.Context, name string, removeTempFiles bool) error {
+	t.logger.Info(ctx, name+" started")
+
+	var removals []removal
+	var onRemoval func(relPath string, entries int)
+	if t.reconciled != nil {
+		onRemoval = func(relPath string, entries int) {
+			removals = append(removals, removal{event: removedEvent(t.source, relPath), entries: entries})
+		}
+	}
+
+	stats, err := t.control.Reconcile(ctx, syncer.ReconcileOptions{
+		Delete: t.cfg.Delete,
+		DryRun: t.cfg.DryRun,
+		Pool:   t.pool,
+
+		OnFailure: func(relPath string, err error) {
+			if client.IsUnreachable(err) {
+				// the whole tree is reconciled once the destination is back
+				t.goOffline(ctx, err)
+				t.setOverflow()
+				return
+			}
+			t.enqueueRetry(ctx, relPath, filepath.Join(t.source, relPath), err)
+		},
+		RemoveTempFiles: removeTempFiles,
+		OnRemoval:       onRemoval,
+	})
+	t.checkRemovals(ctx, removals)
+	if err != nil {
+		return fmt.Errorf("reconcile: %w", err)
+	}
+
+	t.logger.Info(ctx, name+" completed", logger.Fields{
+		"uploaded":   stats.Uploaded,
+		"created":    stats.Created,
+		"removed":    stats.Removed,
+		"up_to_date": stats.UpToDate,
+		"failed":     stats.Failed,
+		"duration":   stats.Duration,
+	})
+
+	return nil
+}
+
+// removeTempFiles removes leftovers of interrupted atomic uploads when the
+// initial sync, which removes them otherwise, is skipped. Failures are only
+// logged.
+func (t *target) removeTempFiles(ctx context.Context) {
+	if t.cfg.DryRun {
+		return
+	}
+
+	if _, err := t.control.RemoveTempFiles(ctx); err != nil && ctx.Err() == nil {
+		t.logger.Warn(ctx, "Failed to remove stale temporary files", logger.Fields{"error": err})
+	}
+}
+
+// purgeTrash removes trash snapshots past the retention period. Failures
+// are only logged, the next attempt may succeed.
+func (t *target) purgeTrash(ctx context.Context) {
+	if t.cfg.DryRun || t.cfg.TrashDir == "" || t.cfg.TrashRetention == 0 {
+		return
+	}
+
+	if _, err := t.control.PurgeTrash(ctx, t.cfg.TrashRetention); err != nil && ctx.Err() == nil {
+		t.logger.Warn(ctx, "Failed to purge trash", logger.Fields{"error": err})
+	}
+}
+
+// submit queues the event to be synced by a worker of the pool. A permanent
+// error stops the destination via cancel.
+func (t *target) submit(event watcher.Event, cancel context.CancelFunc) {
+	paths := []string{event.AbsPath}
+	if event.Type == watcher.EventRenamed {
+		paths = append(paths, event.OldAbsPath)
+	}
+
+	t.pool.Submit(func(ctx context.Context, s *syncer.Syncer) {
+		var err error
+		if event.Type == watcher.EventRenamed {
+			err = s.SyncRename(ctx, event.OldAbsPath, event.AbsPath)
+		} else {
+			err = s.Sync(ctx, event.AbsPath)
+		}
+
+		if err == nil {
+			done := []string{event.RelPath}
+			if event.Type == watcher.EventRenamed {
+				done = append(done, event.OldRelPath)
+			}
+			if qErr := t.queue.Done(done...); qErr != nil {
+				t.logger.Error(ctx, "Failed to update retry queue", qErr)
+			}
+			return
+		}
+
+		if client.IsUnreachable(err) {
+			t.goOffline(ctx, err)
+			t.markDirty(event)
+			return
+		}
+
+		t.logger.Error(ctx, "Failed to sync", err)
+		if client.IsPermanent(err) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			if t.stopErr == nil {
+				t.stopErr = err
+				cancel()
+			}
+			return
+		}
+
+		// a rename is retried as the removal of the old path and the upload
+		// of the new one, so both coalesce with later changes of the paths
+		if event.Type == watcher.EventRenamed {
+			t.enqueueRetry(ctx, event.OldRelPath, event.OldAbsPath, err)
+		}
+		t.enqueueRetry(ctx, event.RelPath, event.AbsPath, err)
+	}, paths...)
+}
+
+// enqueueRetry schedules the next attempt to sync the path.
+func (t *target) enqueueRetry(ctx context.Context, relPath, absPath string, syncErr error) {
+	item, err := t.queue.Add(queue.Item{
+		Path:    relPath,
+		AbsPath: absPath,
+
+		Attempts:    0,
+		LastError:   "",
+		FailedAt:    time.Time{},
+		NextAttempt: time.Time{},
+	}, syncErr, time.Now())
+	if err != nil {
+		t.logger.Error(ctx, "Failed to update retry queue", err)
+		return
+	}
+
+	t.logger.Info(ctx, "Retry scheduled", logger.Fields{
+		"path":         relPath,
+		"attempts":     item.Attempts,
+		"next_attempt": item.NextAttempt.Format(time.TimeOnly),
+	})
+}
+
+// retry submits the queued paths which are due. The current state of every
+// path is synced, whatever the failed change was.
+func (t *target) retry(ctx context.Context, cancel context.CancelFunc) {
+	due := t.queue.Due(time.Now())
+	if len(due) == 0 {
+		return
+	}
+
+	t.logger.Info(ctx, "Retrying failed paths", logger.Fields{"paths": len(due)})
+	for _, item := range due {
+		t.submit(watcher.Event{
+			AbsPath: item.AbsPath,
+			RelPath: item.Path,
+			Type:    watcher.EventModified,
+
+			OldAbsPath: "",
+			OldRelPath: "",
+		}, cancel)
+	}
+}
+
+func (t *target) setOverflow() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.overflow = true
+}
+
+func (t *target) takeOverflow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	overflow := t.overflow
+	t.overflow = false
+
+	return overflow
+}
+
+// fail stops the destination unless the error is caused by the shutdown.
+func (t *target) fail(ctx context.Context, msg string, err error) error {
+	if ctx.Err() != nil {
+		return t.stop(nil)
+	}
+
+	t.logger.Error(ctx, msg, err)
+	return t.stop(err)
+}
+
+// stop records the error which stopped the destination and returns the first
+// one recorded.
+func (t *target) stop(err error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopErr == nil {
+		t.stopErr = err
+	}
+
+	return t.stopErr
+}
+
+// status describes why the destination is out of date, it's empty if the
+// destination is up to date.
+func (t *target) status() (string, logger.Fields) {
+	failed := t.queue.Paths()
+	sort.Strings(failed)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fields := logger.Fields{"dest": t.dest}
+	switch {
+	case t.stopErr != nil:
+		fields["error"] = t.stopErr.Error()
+		return "stopped", fields
+	case t.offline.active:
+		fields["since"] = t.offline.since.Format(time.DateTime)
+		fields["pending"] = len(t.offline.order)
+		return "offline", fields
+	case t.overflow:
+		return "events skipped", fields
+	case len(failed) > 0:
+		fields["failed"] = len(failed)
+		fields["paths"] = failed
+		return "sync failed", fields
+	}
+
+	return "", fields
+}
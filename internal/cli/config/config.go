@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// baseName is the name of the configuration file without extension.
+	baseName = "sftp-sync"
+	// profilesKey holds named sets of options overriding the top level ones.
+	profilesKey = "profiles"
+)
+
+//nolint:gochecknoglobals // constant lookup table
+var extensions = []string{".yaml", ".yml", ".toml"}
+
+// File is a parsed configuration file. Keys are named after the command line
+// options, e.g. dest or dry-run.
+type File struct {
+	Path string
+
+	values   map[string]any
+	profiles map[string]map[string]any
+}
+
+// Find returns the first configuration file found in the directories or an
+// empty string if there is none.
+func Find(dirs ...string) (string, error) {
+	for _, dir := range dirs {
+		for _, ext := range extensions {
+			path := filepath.Join(dir, baseName+ext)
+
+			info, err := os.Stat(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return "", fmt.Errorf("os.Stat: %w", err)
+			}
+			if !info.IsDir() {
+				return path, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// DefaultDirs returns the directories searched for the configuration file:
+// the source directory and the user configuration directory.
+func DefaultDirs(sourceDir string) []string {
+	dirs := []string{sourceDir}
+	if userDir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(userDir, baseName))
+	}
+
+	return dirs
+}
+
+// Load reads the YAML or TOML file, the format is chosen by the extension.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		if _, tomlErr := toml.Decode(string(data), &raw); tomlErr != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFile, path, tomlErr)
+		}
+	default:
+		if yamlErr := yaml.Unmarshal(data, &raw); yamlErr != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidFile, path, yamlErr)
+		}
+	}
+
+	f := &File{
+		Path:     path,
+		values:   raw,
+		profiles: map[string]map[string]any{},
+	}
+
+	if profiles, ok := raw[profilesKey]; ok {
+		delete(f.values, profilesKey)
+
+		table, ok := profiles.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: %s must be a table", ErrInvalidFile, path, profilesKey)
+		}
+		for name, values := range table {
+			profile, isTable := values.(map[string]any)
+			if !isTable {
+				return nil, fmt.Errorf("%w: %s: profile %s must be a table", ErrInvalidFile, path, name)
+			}
+			f.profiles[name] = profile
+		}
+	}
+
+	return f, nil
+}
+
+// Values returns the top level options overridden by the profile ones. An
+// empty profile selects the top level options only.
+func (f *File) Values(profile string) (map[string]any, error) {
+	values := maps.Clone(f.values)
+	if profile == "" {
+		return values, nil
+	}
+
+	overrides, ok := f.profiles[profile]
+	if !ok {
+		names := slices.Sorted(maps.Keys(f.profiles))
+		return nil, fmt.Errorf("%w: %q, available: %s", ErrUnknownProfile, profile, strings.Join(names, ", "))
+	}
+	maps.Copy(values, overrides)
+
+	return values, nil
+}
+
+// Strings converts the option value to strings accepted by the command line
+// parser. Lists produce a string per element.
+func Strings(value any) ([]string, error) {
+	switch v := value.(type) {
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			items, err := Strings(item)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, items...)
+		}
+		return result, nil
+	case map[string]any:
+		return nil, fmt.Errorf("%w: unexpected table", ErrInvalidValue)
+	case nil:
+		return nil, nil
+	}
+
+	return []string{fmt.Sprint(value)}, nil
+}
+
+// Tables converts the option value to a list of tables, e.g. for the list of
+// mappings.
+func Tables(value any) ([]map[string]any, error) {
+	if tables, ok := value.([]map[string]any); ok {
+		// arrays of tables in TOML
+		return tables, nil
+	}
+
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: list of tables expected", ErrInvalidValue)
+	}
+
+	result := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		table, isTable := item.(map[string]any)
+		if !isTable {
+			return nil, fmt.Errorf("%w: list of tables expected", ErrInvalidValue)
+		}
+		result = append(result, table)
+	}
+
+	return result, nil
+}
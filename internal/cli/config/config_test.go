@@ -0,0 +1,130 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/capcom6/sftp-sync/internal/cli/config"
+)
+
+func write(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadProfiles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "yaml",
+			file: "sftp-sync.yaml",
+			content: `
+dest: ftp://staging
+exclude: [.git, "*.log"]
+concurrency: 2
+profiles:
+  prod:
+    dest: ftp://prod
+`,
+		},
+		{
+			name: "toml",
+			file: "sftp-sync.toml",
+			content: `
+dest = "ftp://staging"
+exclude = [".git", "*.log"]
+concurrency = 2
+
+[profiles.prod]
+dest = "ftp://prod"
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			file, err := config.Load(write(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			base, err := file.Values("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if base["dest"] != "ftp://staging" {
+				t.Errorf("dest = %v, want ftp://staging", base["dest"])
+			}
+			if _, ok := base["profiles"]; ok {
+				t.Error("profiles must not be reported as an option")
+			}
+
+			prod, err := file.Values("prod")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prod["dest"] != "ftp://prod" {
+				t.Errorf("dest = %v, want ftp://prod", prod["dest"])
+			}
+
+			excludes, err := config.Strings(prod["exclude"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(excludes, []string{".git", "*.log"}) {
+				t.Errorf("exclude = %v, want [.git *.log]", excludes)
+			}
+
+			concurrency, err := config.Strings(prod["concurrency"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(concurrency, []string{"2"}) {
+				t.Errorf("concurrency = %v, want [2]", concurrency)
+			}
+
+			if _, err = file.Values("dev"); !errors.Is(err, config.ErrUnknownProfile) {
+				t.Errorf("error = %v, want %v", err, config.ErrUnknownProfile)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+
+	path := write(t, "sftp-sync.yml", "dest: ftp://example")
+	empty := t.TempDir()
+
+	found, err := config.Find(empty, filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != path {
+		t.Errorf("found = %q, want %q", found, path)
+	}
+
+	found, err = config.Find(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != "" {
+		t.Errorf("found = %q, want nothing", found)
+	}
+}
@@ -0,0 +1,10 @@
+package config
+
+import "errors"
+
+var (
+	ErrInvalidFile    = errors.New("invalid configuration file")
+	ErrInvalidValue   = errors.New("invalid value")
+	ErrUnknownOption  = errors.New("unknown option")
+	ErrUnknownProfile = errors.New("unknown profile")
+)
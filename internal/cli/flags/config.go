@@ -0,0 +1,180 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/cli/config"
+	"github.com/urfave/cli/v3"
+)
+
+// sourceMetadata is the key of the source directory read from the
+// configuration file in the command metadata.
+const sourceMetadata = "source"
+
+// Config returns the options selecting the configuration file.
+func Config() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "configuration file, sftp-sync.yaml or sftp-sync.toml in the source or user config directory by default",
+			Sources: cli.EnvVars("SFTP_SYNC_CONFIG"),
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Usage:   "named profile of the configuration file",
+			Sources: cli.EnvVars("SFTP_SYNC_PROFILE"),
+		},
+	}
+}
+
+// Before applies the configuration file and checks the source directory.
+func Before(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	if err := applyConfig(cmd, cmd.Args().First()); err != nil {
+		return ctx, cli.Exit(err.Error(), codes.ParamsError)
+	}
+
+	return requireSource(ctx, cmd)
+}
+
+// LoadConfig applies the configuration file of commands without the source
+// directory, it's looked up in the working directory then.
+func LoadConfig(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	if err := applyConfig(cmd, "."); err != nil {
+		return ctx, cli.Exit(err.Error(), codes.ParamsError)
+	}
+
+	return ctx, nil
+}
+
+// SourceDir returns the source directory passed as the argument or read
+// from the configuration file.
+func SourceDir(cmd *cli.Command) string {
+	if source := cmd.StringArg("source"); source != "" {
+		return source
+	}
+
+	source, _ := cmd.Metadata[sourceMetadata].(string)
+	return source
+}
+
+// applyConfig sets the options which are not passed on the command line or
+// via environment variables from the configuration file.
+func applyConfig(cmd *cli.Command, sourceDir string) error {
+	path := cmd.String("config")
+	if path == "" {
+		if sourceDir == "" {
+			sourceDir = "."
+		}
+
+		found, err := config.Find(config.DefaultDirs(sourceDir)...)
+		if err != nil {
+			return fmt.Errorf("can't find configuration file: %w", err)
+		}
+		path = found
+	}
+
+	profile := cmd.String("profile")
+	if path == "" {
+		if profile != "" {
+			return fmt.Errorf("%w: %q, no configuration file found", config.ErrUnknownProfile, profile)
+		}
+		return nil
+	}
+
+	file, err := config.Load(path)
+	if err != nil {
+		return fmt.Errorf("can't load configuration file: %w", err)
+	}
+
+	values, err := file.Values(profile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file.Path, err)
+	}
+
+	for name, value := range values {
+		if optErr := applyOption(cmd, file, name, value); optErr != nil {
+			return fmt.Errorf("%s: option %s: %w", file.Path, name, optErr)
+		}
+	}
+
+	return nil
+}
+
+func applyOption(cmd *cli.Command, file *config.File, name string, value any) error {
+	if name == mappingsMetadata {
+		mappings, err := parseMappings(file, value)
+		if err != nil {
+			return err
+		}
+
+		setMetadata(cmd, mappingsMetadata, mappings)
+		return nil
+	}
+
+	values, err := config.Strings(value)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	if name == sourceMetadata {
+		if len(values) != 1 {
+			return config.ErrInvalidValue
+		}
+
+		// relative to the configuration file rather than the working directory
+		source := values[0]
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(filepath.Dir(file.Path), source)
+		}
+
+		setMetadata(cmd, sourceMetadata, source)
+		return nil
+	}
+
+	if !hasFlag(cmd, name) {
+		if hasFlagRecursive(cmd.Root(), name) {
+			// an option of another command
+			return nil
+		}
+		return config.ErrUnknownOption
+	}
+
+	if cmd.IsSet(name) {
+		return nil
+	}
+
+	for _, v := range values {
+		if setErr := cmd.Set(name, v); setErr != nil {
+			return fmt.Errorf("%w: %w", config.ErrInvalidValue, setErr)
+		}
+	}
+
+	return nil
+}
+
+func setMetadata(cmd *cli.Command, key string, value any) {
+	if cmd.Metadata == nil {
+		cmd.Metadata = map[string]any{}
+	}
+	cmd.Metadata[key] = value
+}
+
+func hasFlag(cmd *cli.Command, name string) bool {
+	return slices.ContainsFunc(cmd.Flags, func(f cli.Flag) bool {
+		return slices.Contains(f.Names(), name)
+	})
+}
+
+func hasFlagRecursive(cmd *cli.Command, name string) bool {
+	if hasFlag(cmd, name) {
+		return true
+	}
+
+	return slices.ContainsFunc(cmd.Commands, func(sub *cli.Command) bool {
+		return hasFlagRecursive(sub, name)
+	})
+}
@@ -0,0 +1,211 @@
+package flags
+
+import (
+	"context"
+
+	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/exclude"
+	"github.com/urfave/cli/v3"
+)
+
+// Source returns the positional argument with the local directory.
+func Source(usage string) cli.Argument {
+	return &cli.StringArg{
+		Name:      "source",
+		UsageText: usage,
+		Config: cli.StringConfig{
+			TrimSpace: true,
+		},
+	}
+}
+
+// requireSource checks that exactly one source directory is passed, unless
+// it's set in the configuration file or mappings are used.
+func requireSource(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	switch cmd.Args().Len() {
+	case 1:
+		return ctx, nil
+	case 0:
+		if _, ok := cmd.Metadata[sourceMetadata]; ok || hasMappings(cmd) {
+			return ctx, nil
+		}
+	}
+
+	return ctx, cli.Exit("exactly one argument is required", codes.ParamsError)
+}
+
+// Sync returns the options shared by all commands which transfer files:
+// the configuration file, the destinations and mappings, client settings,
+// includes and excludes, dry run mode, concurrency and the trash.
+func Sync() []cli.Flag {
+	fs := append(Config(),
+		&cli.StringSliceFlag{
+			Name:  "dest",
+			Usage: "destination URL (ftp, ftps, ftpes, sftp, webdav, webdavs, s3 or file scheme), can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "map",
+			Usage: "additional SOURCE=DEST mapping, can be repeated, also with the same source",
+		},
+		&cli.StringSliceFlag{
+			Name:  "include",
+			Usage: "paths or glob patterns of files to sync, others are skipped (supports *, **, ?)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "paths or glob patterns to exclude (supports *, **, ?), !pattern re-includes excluded paths",
+		},
+		&cli.BoolFlag{
+			Name:  "ignore-files",
+			Usage: "exclude paths listed in .syncignore files of the source tree",
+			Value: true,
+		},
+		&cli.BoolFlag{
+			Name:  "gitignore",
+			Usage: "also exclude paths listed in .gitignore files, unless --ignore-files is disabled",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "perform a dry run without actually syncing files",
+		},
+		&cli.StringFlag{
+			Name:  "compare",
+			Usage: "how to detect unchanged files to skip: size-mtime, hash or none",
+			Value: "size-mtime",
+		},
+		&cli.IntFlag{
+			Name:  "concurrency",
+			Usage: "number of files transferred in parallel, each over its own connection",
+			Value: 1,
+		},
+		Trash(),
+		TrashRetention(),
+	)
+
+	return append(fs, Client()...)
+}
+
+// Client returns the options of the remote client.
+func Client() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "ssh-key",
+			Usage:   "private key file for SFTP authentication",
+			Sources: cli.EnvVars("SSH_KEY"),
+		},
+		&cli.StringFlag{
+			Name:    "ssh-key-passphrase",
+			Usage:   "passphrase of encrypted private keys",
+			Sources: cli.EnvVars("SSH_KEY_PASSPHRASE"),
+		},
+		&cli.BoolFlag{
+			Name:  "ssh-agent",
+			Usage: "authenticate via ssh-agent available at SSH_AUTH_SOCK",
+			Value: true,
+		},
+		&cli.StringFlag{
+			Name:  "known-hosts",
+			Usage: "known_hosts file used to verify SFTP host keys",
+			Value: "~/.ssh/known_hosts",
+		},
+		&cli.BoolFlag{
+			Name:  "accept-new-host-keys",
+			Usage: "add keys of unknown hosts to known_hosts instead of rejecting them",
+		},
+
+		&cli.BoolFlag{
+			Name:  "atomic-uploads",
+			Usage: "upload to a temporary name and rename it over the target once completed",
+		},
+
+		&cli.StringFlag{
+			Name:  "tls-ca",
+			Usage: "PEM bundle of certificate authorities trusted by FTPS, WebDAV and S3 connections",
+		},
+		&cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "client certificate for FTPS, WebDAV and S3 connections",
+		},
+		&cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "private key of the client certificate",
+		},
+		&cli.BoolFlag{
+			Name:  "tls-insecure-skip-verify",
+			Usage: "don't verify the FTPS, WebDAV or S3 server certificate (for self-signed staging servers only)",
+		},
+
+		&cli.StringFlag{
+			Name:    "s3-endpoint",
+			Usage:   "endpoint of an S3-compatible service, e.g. http://localhost:9000 for MinIO",
+			Sources: cli.EnvVars("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"),
+		},
+		&cli.StringFlag{
+			Name:    "s3-region",
+			Usage:   "region of the S3 bucket, detected automatically if empty",
+			Sources: cli.EnvVars("AWS_REGION"),
+		},
+	}
+}
+
+// ClientOptions reads the options returned by Client.
+func ClientOptions(cmd *cli.Command) client.Options {
+	return client.Options{
+		SSH: client.SSHOptions{
+			KeyFiles:          cmd.StringSlice("ssh-key"),
+			KeyPassphrase:     cmd.String("ssh-key-passphrase"),
+			UseAgent:          cmd.Bool("ssh-agent"),
+			KnownHostsFile:    cmd.String("known-hosts"),
+			AcceptNewHostKeys: cmd.Bool("accept-new-host-keys"),
+		},
+		TLS: client.TLSOptions{
+			CAFile:             cmd.String("tls-ca"),
+			CertFile:           cmd.String("tls-cert"),
+			KeyFile:            cmd.String("tls-key"),
+			InsecureSkipVerify: cmd.Bool("tls-insecure-skip-verify"),
+		},
+		S3: client.S3Options{
+			Endpoint: cmd.String("s3-endpoint"),
+			Region:   cmd.String("s3-region"),
+		},
+		Upload: client.UploadOptions{
+			Atomic: cmd.Bool("atomic-uploads"),
+		},
+	}
+}
+
+// IgnoreFiles returns the names of the ignore files to honour, lowest
+// precedence first. .gitignore is opt-in, as build output is often ignored
+// by git but still has to be deployed.
+func IgnoreFiles(cmd *cli.Command) []string {
+	if !cmd.Bool("ignore-files") {
+		return nil
+	}
+	if cmd.Bool("gitignore") {
+		return []string{exclude.GitIgnoreFile, exclude.SyncIgnoreFile}
+	}
+
+	return []string{exclude.SyncIgnoreFile}
+}
+
+// Local marks the flags as not inherited by subcommands, so the root command
+// can accept the sync options without leaking them into other commands.
+// Slice flags are left persistent: local ones are reset on every value, so
+// only the last one would be kept, and subcommands declare their own anyway.
+func Local(fs []cli.Flag) []cli.Flag {
+	for _, f := range fs {
+		switch f := f.(type) {
+		case *cli.BoolFlag:
+			f.Local = true
+		case *cli.DurationFlag:
+			f.Local = true
+		case *cli.IntFlag:
+			f.Local = true
+		case *cli.StringFlag:
+			f.Local = true
+		}
+	}
+
+	return fs
+}
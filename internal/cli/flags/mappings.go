@@ -0,0 +1,144 @@
+package flags
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/capcom6/sftp-sync/internal/cli/config"
+	"github.com/urfave/cli/v3"
+)
+
+// mappingsMetadata is the key of the mappings read from the configuration
+// file in the command metadata.
+const mappingsMetadata = "mappings"
+
+// Mapping pairs a source directory with its destinations.
+type Mapping struct {
+	Source   string
+	Dests    []string
+	Includes []string
+	Excludes []string
+}
+
+// Mappings returns the source directory with the destinations set by the
+// options, followed by additional mappings from the --map option or the
+// configuration file. Includes and excludes of the options apply to every
+// mapping.
+func Mappings(cmd *cli.Command) ([]Mapping, error) {
+	includes := cmd.StringSlice("include")
+	excludes := cmd.StringSlice("exclude")
+
+	var mappings []Mapping
+	if source := SourceDir(cmd); source != "" {
+		mappings = append(mappings, Mapping{
+			Source:   source,
+			Dests:    cmd.StringSlice("dest"),
+			Includes: includes,
+			Excludes: excludes,
+		})
+	}
+
+	extra, _ := cmd.Metadata[mappingsMetadata].([]Mapping)
+	if cmd.IsSet("map") {
+		var err error
+		if extra, err = parseMapOption(cmd.StringSlice("map")); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range extra {
+		m.Includes = append(append([]string{}, includes...), m.Includes...)
+		m.Excludes = append(append([]string{}, excludes...), m.Excludes...)
+		mappings = append(mappings, m)
+	}
+
+	return mappings, nil
+}
+
+// parseMapOption parses the SOURCE=DEST values, destinations of the same
+// source are merged into a single mapping.
+func parseMapOption(values []string) ([]Mapping, error) {
+	mappings := make([]Mapping, 0, len(values))
+	for _, value := range values {
+		source, dest, ok := strings.Cut(value, "=")
+		if !ok || source == "" || dest == "" {
+			return nil, fmt.Errorf("%w: mapping %q, SOURCE=DEST expected", config.ErrInvalidValue, value)
+		}
+
+		i := slices.IndexFunc(mappings, func(m Mapping) bool { return m.Source == source })
+		if i >= 0 {
+			mappings[i].Dests = append(mappings[i].Dests, dest)
+			continue
+		}
+
+		mappings = append(mappings, Mapping{
+			Source:   source,
+			Dests:    []string{dest},
+			Includes: nil,
+			Excludes: nil,
+		})
+	}
+
+	return mappings, nil
+}
+
+func hasMappings(cmd *cli.Command) bool {
+	_, ok := cmd.Metadata[mappingsMetadata]
+	return ok || cmd.IsSet("map")
+}
+
+// parseMappings reads the list of mappings of the configuration file.
+func parseMappings(file *config.File, value any) ([]Mapping, error) {
+	tables, err := config.Tables(value)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by the caller
+	}
+
+	mappings := make([]Mapping, 0, len(tables))
+	for i, table := range tables {
+		m := Mapping{
+			Source:   "",
+			Dests:    nil,
+			Includes: nil,
+			Excludes: nil,
+		}
+
+		for key, v := range table {
+			values, strErr := config.Strings(v)
+			if strErr != nil {
+				return nil, fmt.Errorf("mapping %d: %s: %w", i+1, key, strErr)
+			}
+
+			switch key {
+			case "source":
+				if len(values) != 1 {
+					return nil, fmt.Errorf("mapping %d: %s: %w", i+1, key, config.ErrInvalidValue)
+				}
+				m.Source = values[0]
+			case "dest":
+				m.Dests = values
+			case "include":
+				m.Includes = values
+			case "exclude":
+				m.Excludes = values
+			default:
+				return nil, fmt.Errorf("mapping %d: %w: %s", i+1, config.ErrUnknownOption, key)
+			}
+		}
+
+		if m.Source == "" || len(m.Dests) == 0 {
+			return nil, fmt.Errorf("mapping %d: %w: source and dest are required", i+1, config.ErrInvalidValue)
+		}
+
+		// relative to the configuration file rather than the working directory
+		if !filepath.IsAbs(m.Source) {
+			m.Source = filepath.Join(filepath.Dir(file.Path), m.Source)
+		}
+
+		mappings = append(mappings, m)
+	}
+
+	return mappings, nil
+}
@@ -0,0 +1,46 @@
+package flags
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/cli/config"
+	"github.com/urfave/cli/v3"
+)
+
+// defaultTrashRetention is how long removed entries are kept in the trash.
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// Trash returns the option selecting the remote trash directory.
+func Trash() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "trash",
+		Usage: "move removed entries to timestamped snapshots of this remote directory, relative to the destination",
+	}
+}
+
+// TrashRetention returns the option limiting the age of the trash.
+func TrashRetention() cli.Flag {
+	return &cli.DurationFlag{
+		Name:  "trash-retention",
+		Usage: "purge trash snapshots older than this, 0 to keep them forever",
+		Value: defaultTrashRetention,
+	}
+}
+
+// TrashDir reads the option returned by Trash.
+func TrashDir(cmd *cli.Command) (string, error) {
+	dir := cmd.String("trash")
+	if dir == "" {
+		return "", nil
+	}
+
+	dir = path.Clean(filepath.ToSlash(dir))
+	if path.IsAbs(dir) || filepath.IsAbs(dir) || dir == "." {
+		return "", fmt.Errorf("%w: trash %q, a path relative to the destination expected", config.ErrInvalidValue, dir)
+	}
+
+	return dir, nil
+}
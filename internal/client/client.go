@@ -3,11 +3,31 @@ package client
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"net/url"
+	"time"
 
 	logger "github.com/go-core-fx/cli-logger"
 )
 
+const (
+	EntryTypeFile EntryType = "file"
+	EntryTypeDir  EntryType = "dir"
+	EntryTypeLink EntryType = "link"
+)
+
+type EntryType string
+
+// Entry describes a remote file or directory in a backend-neutral way.
+type Entry struct {
+	Name    string
+	Type    EntryType
+	Size    int64
+	ModTime time.Time
+	// Mode holds permission bits, zero if the backend doesn't report them.
+	Mode fs.FileMode
+}
+
 type Client interface {
 	MakeDir(ctx context.Context, remotePath string) error
 	RemoveDir(ctx context.Context, remotePath string) error
@@ -16,17 +36,46 @@ type Client interface {
 	RemoveFile(ctx context.Context, remotePath string) error
 
 	Remove(ctx context.Context, remotePath string) error
+	// Rename moves the remote file or directory, missing parents of the
+	// target are created and an existing target is replaced.
+	Rename(ctx context.Context, fromPath, toPath string) error
+
+	// Stat returns the remote entry or ErrNotFound if it doesn't exist.
+	Stat(ctx context.Context, remotePath string) (Entry, error)
+	// List returns entries of the remote directory. A missing directory is
+	// reported as empty.
+	List(ctx context.Context, remoteDir string) ([]Entry, error)
 }
 
-func New(address string, log logger.Logger) (Client, error) {
+func New(address string, options Options, log logger.Logger) (Client, error) {
 	u, err := url.Parse(address)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse URL: %w", err)
 	}
 
-	if u.Scheme == "ftp" {
-		return NewFtpClient(address, log.WithContext("client", "")), nil
+	switch u.Scheme {
+	case "ftp", "ftps", "ftpes":
+		return NewFtpClient(address, options.TLS, options.Upload, log.WithContext("client", "")), nil
+	case "sftp":
+		return NewSftpClient(address, options.SSH, options.Upload, log.WithContext("client", "")), nil
+	case "webdav", "webdavs":
+		return NewWebdavClient(address, options.TLS, options.Upload, log.WithContext("client", "")), nil
+	case "file":
+		return NewFileClient(address, log.WithContext("client", "")), nil
+	case "s3":
+		return NewS3Client(address, options.S3, options.TLS, log.WithContext("client", "")), nil
 	}
 
 	return nil, fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
 }
+
+// Redact returns the address with the password replaced by "xxxxx", so it
+// can be logged or printed.
+func Redact(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return address
+	}
+
+	return u.Redacted()
+}
@@ -0,0 +1,179 @@
+package clienttest
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+
+	ftpserver "github.com/fclairamb/ftpserverlib"
+	"github.com/spf13/afero"
+)
+
+const (
+	ftpUser     = "user"
+	ftpPassword = "pw"
+)
+
+var errBadCredentials = errors.New("bad credentials")
+
+// FTPServer is an in-process FTP server serving a temporary directory. It's
+// stopped when the test ends.
+type FTPServer struct {
+	root   string
+	server *ftpserver.FtpServer
+	served chan struct{}
+	stop   sync.Once
+
+	mu      sync.Mutex
+	clients map[uint32]ftpserver.ClientContext
+	// noOverwrite makes renames over existing files fail
+	noOverwrite bool
+}
+
+// NewFTPServer starts the server on a random local port.
+func NewFTPServer(tb testing.TB) *FTPServer {
+	tb.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("can't listen: %v", err)
+	}
+
+	s := &FTPServer{
+		root:   tb.TempDir(),
+		server: nil,
+		served: make(chan struct{}),
+		stop:   sync.Once{},
+
+		mu:          sync.Mutex{},
+		clients:     map[uint32]ftpserver.ClientContext{},
+		noOverwrite: false,
+	}
+	s.server = ftpserver.NewFtpServer(&ftpDriver{server: s, listener: listener})
+
+	if listenErr := s.server.Listen(); listenErr != nil {
+		tb.Fatalf("can't start FTP server: %v", listenErr)
+	}
+	go func() {
+		defer close(s.served)
+		_ = s.server.Serve()
+	}()
+	tb.Cleanup(s.Close)
+
+	return s
+}
+
+// URL returns the address of the server with valid credentials.
+func (s *FTPServer) URL() string {
+	u := url.URL{ //nolint:exhaustruct // only the relevant parts
+		Scheme: "ftp",
+		User:   url.UserPassword(ftpUser, ftpPassword),
+		Host:   s.server.Addr(),
+		Path:   "/",
+	}
+
+	return u.String()
+}
+
+// Root returns the directory served by the server.
+func (s *FTPServer) Root() string {
+	return s.root
+}
+
+// Disconnect closes the connections of all clients, the server keeps
+// accepting new ones.
+func (s *FTPServer) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, cc := range s.clients {
+		_ = cc.Close()
+		delete(s.clients, id)
+	}
+}
+
+// RefuseOverwrite makes renames over existing files fail for new
+// connections, like some servers do.
+func (s *FTPServer) RefuseOverwrite() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.noOverwrite = true
+}
+
+// Close stops the server and disconnects the clients. It can be called more
+// than once.
+func (s *FTPServer) Close() {
+	s.stop.Do(func() {
+		_ = s.server.Stop()
+		<-s.served
+	})
+	s.Disconnect()
+}
+
+// ftpDriver serves the root directory to a single user.
+type ftpDriver struct {
+	server   *FTPServer
+	listener net.Listener
+}
+
+func (d *ftpDriver) GetSettings() (*ftpserver.Settings, error) {
+	return &ftpserver.Settings{ //nolint:exhaustruct // defaults of the library
+		Listener:   d.listener,
+		PublicHost: "127.0.0.1",
+	}, nil
+}
+
+func (d *ftpDriver) ClientConnected(cc ftpserver.ClientContext) (string, error) {
+	d.server.mu.Lock()
+	defer d.server.mu.Unlock()
+
+	d.server.clients[cc.ID()] = cc
+
+	return "test server", nil
+}
+
+func (d *ftpDriver) ClientDisconnected(cc ftpserver.ClientContext) {
+	d.server.mu.Lock()
+	defer d.server.mu.Unlock()
+
+	delete(d.server.clients, cc.ID())
+}
+
+func (d *ftpDriver) AuthUser(_ ftpserver.ClientContext, user, pass string) (ftpserver.ClientDriver, error) {
+	if user != ftpUser || pass != ftpPassword {
+		return nil, fmt.Errorf("%w: %s", errBadCredentials, user)
+	}
+
+	d.server.mu.Lock()
+	defer d.server.mu.Unlock()
+
+	fs := afero.NewBasePathFs(afero.NewOsFs(), d.server.root)
+	if d.server.noOverwrite {
+		return noOverwriteFs{Fs: fs}, nil
+	}
+
+	return fs, nil
+}
+
+func (d *ftpDriver) GetTLSConfig() (*tls.Config, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// noOverwriteFs fails renames over existing entries.
+type noOverwriteFs struct {
+	afero.Fs
+}
+
+func (f noOverwriteFs) Rename(oldname, newname string) error {
+	if _, err := f.Stat(newname); err == nil {
+		return fmt.Errorf("can't rename %s to %s: %w", oldname, newname, os.ErrExist)
+	}
+
+	return f.Fs.Rename(oldname, newname) //nolint:wrapcheck // the error of the wrapped fs
+}
@@ -0,0 +1,436 @@
+// Package clienttest provides test doubles of the remote clients: an
+// in-memory client.Client and an in-process FTP server.
+package clienttest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+)
+
+// Names of the recorded operations, they match the methods of client.Client.
+const (
+	OpMakeDir    = "MakeDir"
+	OpRemoveDir  = "RemoveDir"
+	OpUploadFile = "UploadFile"
+	OpRemoveFile = "RemoveFile"
+	OpRemove     = "Remove"
+	OpRename     = "Rename"
+	OpStat       = "Stat"
+	OpList       = "List"
+)
+
+const (
+	memoryDirMode  = 0o755
+	memoryFileMode = 0o644
+)
+
+// Op is a recorded call of the client. To is set for renames only.
+type Op struct {
+	Name string
+	Path string
+	To   string
+}
+
+func (o Op) String() string {
+	if o.To != "" {
+		return o.Name + " " + o.Path + " " + o.To
+	}
+
+	return o.Name + " " + o.Path
+}
+
+type memoryEntry struct {
+	dir     bool
+	data    []byte
+	modTime time.Time
+}
+
+type fault struct {
+	op    string
+	path  string
+	err   error
+	times int
+}
+
+// Memory is a client.Client keeping the remote tree in memory. It records
+// every call, and failures and latency can be injected to emulate a flaky
+// server. It's safe for concurrent use.
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+	ops     []Op
+	faults  []*fault
+	latency time.Duration
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		mu:      sync.Mutex{},
+		entries: map[string]*memoryEntry{},
+		ops:     nil,
+		faults:  nil,
+		latency: 0,
+	}
+}
+
+// Fail makes the next calls of the operation on the path return err. An
+// empty op or path matches any. The fault is removed after the given number
+// of calls, or is kept until Recover if times isn't positive.
+func (m *Memory) Fail(op, remotePath string, err error, times int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if remotePath != "" {
+		remotePath = clean(remotePath)
+	}
+	m.faults = append(m.faults, &fault{op: op, path: remotePath, err: err, times: times})
+}
+
+// Recover removes all injected failures.
+func (m *Memory) Recover() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.faults = nil
+}
+
+// SetLatency delays every call, the delay is interrupted by the context.
+func (m *Memory) SetLatency(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.latency = d
+}
+
+// Ops returns the recorded calls in order, including the failed ones.
+func (m *Memory) Ops() []Op {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.ops)
+}
+
+// ResetOps forgets the recorded calls.
+func (m *Memory) ResetOps() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ops = nil
+}
+
+// WriteFile stores the file, creating missing parents, without recording
+// the call. It's meant to prepare the remote tree.
+func (m *Memory) WriteFile(remotePath string, data []byte, modTime time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remotePath = clean(remotePath)
+	m.makeParents(remotePath)
+	m.entries[remotePath] = &memoryEntry{dir: false, data: slices.Clone(data), modTime: modTime}
+}
+
+// ReadFile returns the content of the remote file.
+func (m *Memory) ReadFile(remotePath string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[clean(remotePath)]
+	if !ok || entry.dir {
+		return nil, false
+	}
+
+	return slices.Clone(entry.data), true
+}
+
+// Paths returns the sorted paths of all remote entries, directories end
+// with a slash.
+func (m *Memory) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.entries))
+	for p, entry := range m.entries {
+		if entry.dir {
+			p += "/"
+		}
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	return paths
+}
+
+func (m *Memory) MakeDir(ctx context.Context, remotePath string) error {
+	remotePath = clean(remotePath)
+	if err := m.call(ctx, Op{Name: OpMakeDir, Path: remotePath, To: ""}); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[remotePath]; ok && !entry.dir {
+		return fmt.Errorf("can't make directory %s: %w", remotePath, fs.ErrExist)
+	}
+	m.makeParents(remotePath)
+	m.makeDir(remotePath)
+
+	return nil
+}
+
+func (m *Memory) RemoveDir(ctx context.Context, remotePath string) error {
+	remotePath = clean(remotePath)
+	if err := m.call(ctx, Op{Name: OpRemoveDir, Path: remotePath, To: ""}); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeTree(remotePath)
+
+	return nil
+}
+
+func (m *Memory) UploadFile(ctx context.Context, remotePath string, localPath string) error {
+	remotePath = clean(remotePath)
+	if err := m.call(ctx, Op{Name: OpUploadFile, Path: remotePath, To: ""}); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return fmt.Errorf("can't open local file %s: %w", localPath, err)
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("can't stat local file %s: %w", localPath, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[remotePath]; ok && entry.dir {
+		return fmt.Errorf("can't upload file to %s: %w", remotePath, fs.ErrExist)
+	}
+	m.makeParents(remotePath)
+	// like the real backends, the modification time is preserved
+	m.entries[remotePath] = &memoryEntry{dir: false, data: data, modTime: info.ModTime()}
+
+	return nil
+}
+
+func (m *Memory) RemoveFile(ctx context.Context, remotePath string) error {
+	remotePath = clean(remotePath)
+	if err := m.call(ctx, Op{Name: OpRemoveFile, Path: remotePath, To: ""}); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.entries[remotePath]; ok && !entry.dir {
+		delete(m.entries, remotePath)
+	}
+
+	return nil
+}
+
+func (m *Memory) Remove(ctx context.Context, remotePath string) error {
+	remotePath = clean(remotePath)
+	if err := m.call(ctx, Op{Name: OpRemove, Path: remotePath, To: ""}); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeTree(remotePath)
+
+	return nil
+}
+
+func (m *Memory) Rename(ctx context.Context, fromPath, toPath string) error {
+	fromPath, toPath = clean(fromPath), clean(toPath)
+	if err := m.call(ctx, Op{Name: OpRename, Path: fromPath, To: toPath}); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.entries[fromPath]; !ok {
+		return fmt.Errorf("can't rename %s to %s: %w: %s", fromPath, toPath, client.ErrNotFound, fromPath)
+	}
+	if fromPath == toPath {
+		return nil
+	}
+
+	m.removeTree(toPath)
+	m.makeParents(toPath)
+	moved := map[string]*memoryEntry{}
+	for p, entry := range m.entries {
+		if p == fromPath || strings.HasPrefix(p, fromPath+"/") {
+			delete(m.entries, p)
+			moved[toPath+strings.TrimPrefix(p, fromPath)] = entry
+		}
+	}
+	maps.Copy(m.entries, moved)
+
+	return nil
+}
+
+func (m *Memory) Stat(ctx context.Context, remotePath string) (client.Entry, error) {
+	remotePath = clean(remotePath)
+	if err := m.call(ctx, Op{Name: OpStat, Path: remotePath, To: ""}); err != nil {
+		return client.Entry{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if remotePath == "." {
+		return client.Entry{Name: ".", Type: client.EntryTypeDir, Size: 0, ModTime: time.Time{}, Mode: memoryDirMode}, nil
+	}
+
+	entry, ok := m.entries[remotePath]
+	if !ok {
+		return client.Entry{}, fmt.Errorf("%w: %s", client.ErrNotFound, remotePath)
+	}
+
+	return memoryEntryOf(path.Base(remotePath), entry), nil
+}
+
+func (m *Memory) List(ctx context.Context, remoteDir string) ([]client.Entry, error) {
+	remoteDir = clean(remoteDir)
+	if err := m.call(ctx, Op{Name: OpList, Path: remoteDir, To: ""}); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []client.Entry{}
+	for p, entry := range m.entries {
+		if path.Dir(p) == remoteDir {
+			result = append(result, memoryEntryOf(path.Base(p), entry))
+		}
+	}
+	slices.SortFunc(result, func(a, b client.Entry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return result, nil
+}
+
+// PreservesModTime reports true, uploaded files keep the local time.
+func (m *Memory) PreservesModTime(_ context.Context) (bool, error) {
+	return true, nil
+}
+
+// call records the operation, waits for the latency and returns the
+// injected failure, if any.
+func (m *Memory) call(ctx context.Context, op Op) error {
+	m.mu.Lock()
+	m.ops = append(m.ops, op)
+	latency := m.latency
+	err := m.fault(op)
+	m.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+func (m *Memory) fault(op Op) error {
+	for i, f := range m.faults {
+		if f.op != "" && f.op != op.Name {
+			continue
+		}
+		if f.path != "" && f.path != op.Path {
+			continue
+		}
+
+		if f.times > 0 {
+			f.times--
+			if f.times == 0 {
+				m.faults = slices.Delete(m.faults, i, i+1)
+			}
+		}
+
+		return fmt.Errorf("%s %s: %w", op.Name, op.Path, f.err)
+	}
+
+	return nil
+}
+
+func (m *Memory) makeParents(remotePath string) {
+	for dir := path.Dir(remotePath); dir != "."; dir = path.Dir(dir) {
+		m.makeDir(dir)
+	}
+}
+
+func (m *Memory) makeDir(remotePath string) {
+	if remotePath == "." {
+		return
+	}
+	if _, ok := m.entries[remotePath]; !ok {
+		m.entries[remotePath] = &memoryEntry{dir: true, data: nil, modTime: time.Now()}
+	}
+}
+
+func (m *Memory) removeTree(remotePath string) {
+	if remotePath == "." {
+		clear(m.entries)
+		return
+	}
+
+	for p := range m.entries {
+		if p == remotePath || strings.HasPrefix(p, remotePath+"/") {
+			delete(m.entries, p)
+		}
+	}
+}
+
+func memoryEntryOf(name string, entry *memoryEntry) client.Entry {
+	if entry.dir {
+		return client.Entry{Name: name, Type: client.EntryTypeDir, Size: 0, ModTime: entry.modTime, Mode: memoryDirMode}
+	}
+
+	return client.Entry{
+		Name:    name,
+		Type:    client.EntryTypeFile,
+		Size:    int64(len(entry.data)),
+		ModTime: entry.modTime,
+		Mode:    memoryFileMode,
+	}
+}
+
+// clean maps the path to the form used as the key, "." is the root.
+func clean(remotePath string) string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+remotePath), "/")
+	if cleaned == "" {
+		return "."
+	}
+
+	return cleaned
+}
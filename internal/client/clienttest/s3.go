@@ -0,0 +1,57 @@
+package clienttest
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+const (
+	s3Bucket    = "bucket"
+	s3AccessKey = "key"
+	s3SecretKey = "secret"
+)
+
+// S3Server is an in-process S3 server keeping the objects in memory. It has
+// a single bucket and is stopped when the test ends.
+type S3Server struct {
+	server *httptest.Server
+}
+
+// NewS3Server starts the server on a random local port.
+func NewS3Server(tb testing.TB) *S3Server {
+	tb.Helper()
+
+	backend := s3mem.New()
+	if err := backend.CreateBucket(s3Bucket); err != nil {
+		tb.Fatalf("can't create bucket: %v", err)
+	}
+
+	s := &S3Server{
+		server: httptest.NewServer(gofakes3.New(backend).Server()),
+	}
+	tb.Cleanup(s.server.Close)
+
+	return s
+}
+
+// URL returns the destination URL of the bucket with valid credentials.
+func (s *S3Server) URL() string {
+	u := url.URL{ //nolint:exhaustruct // only the relevant parts
+		Scheme: "s3",
+		User:   url.UserPassword(s3AccessKey, s3SecretKey),
+		Host:   s3Bucket,
+		Path:   "/",
+	}
+
+	return u.String()
+}
+
+// Endpoint returns the address of the server, to be passed as the S3
+// endpoint.
+func (s *S3Server) Endpoint() string {
+	return s.server.URL
+}
@@ -1,8 +1,50 @@
 package client
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net"
+)
 
 var (
 	ErrUnsupportedScheme = errors.New("unsupported scheme")
 	ErrClientIsNil       = errors.New("client is nil")
+	ErrNotFound          = errors.New("not found")
+	ErrHashNotSupported  = errors.New("hash is not supported")
+	ErrUnreachable       = errors.New("server is unreachable")
+	ErrInvalidURL        = errors.New("invalid URL")
+
+	ErrHostKeyMismatch    = errors.New("host key mismatch")
+	ErrHostKeyUnknown     = errors.New("unknown host key")
+	ErrPassphraseRequired = errors.New("passphrase required")
+	ErrInvalidCertificate = errors.New("invalid certificate")
+	ErrBucketNotFound     = errors.New("bucket not found")
 )
+
+// IsPermanent reports whether err can't be fixed by retrying the operation
+// and requires changes in the configuration instead.
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrUnsupportedScheme) ||
+		errors.Is(err, ErrHostKeyMismatch) ||
+		errors.Is(err, ErrHostKeyUnknown) ||
+		errors.Is(err, ErrPassphraseRequired) ||
+		errors.Is(err, ErrInvalidCertificate) ||
+		errors.Is(err, ErrBucketNotFound) ||
+		errors.Is(err, ErrInvalidURL)
+}
+
+// IsUnreachable reports whether err is caused by a failed connection to the
+// server, so the operation may succeed once the server is back.
+func IsUnreachable(err error) bool {
+	return errors.Is(err, ErrUnreachable)
+}
+
+// markUnreachable marks errors of HTTP requests which didn't reach the server.
+func markUnreachable(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,305 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+const (
+	fileDirMode = 0o755
+)
+
+// FileClient syncs to a local directory, e.g. a mounted network share or a
+// bind mount. Files are always written to a temporary name and renamed over
+// the target, keeping the modification time and permissions of the source.
+//
+// A missing root directory is reported as unreachable, as it's usually an
+// unmounted share.
+type FileClient struct {
+	url string
+
+	logger logger.Logger
+
+	root string
+	lock sync.Mutex
+}
+
+func NewFileClient(url string, logger logger.Logger) *FileClient {
+	return &FileClient{
+		url: url,
+
+		logger: logger,
+
+		root: "",
+		lock: sync.Mutex{},
+	}
+}
+
+func (c *FileClient) init(_ context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.root == "" {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			return fmt.Errorf("can't parse URL: %w", err)
+		}
+
+		if u.Scheme != "file" {
+			return fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			return fmt.Errorf("%w: remote host %s, use file:///path", ErrInvalidURL, u.Host)
+		}
+		if u.Path == "" {
+			return fmt.Errorf("%w: empty path", ErrInvalidURL)
+		}
+
+		c.root = filepath.FromSlash(u.Path)
+	}
+
+	info, err := os.Stat(c.root)
+	if err != nil {
+		return fmt.Errorf("can't open directory %s: %w: %w", c.root, ErrUnreachable, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("can't open directory %s: %w", c.root, ErrInvalidURL)
+	}
+
+	return nil
+}
+
+func (c *FileClient) MakeDir(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.resolve(remotePath), fileDirMode); err != nil {
+		return fmt.Errorf("can't make directory %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+func (c *FileClient) RemoveDir(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(c.resolve(remotePath)); err != nil {
+		return fmt.Errorf("can't remove directory %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+func (c *FileClient) UploadFile(ctx context.Context, remotePath string, localPath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	dir, _ := path.Split(remotePath)
+	if err := c.MakeDir(ctx, dir); err != nil {
+		return err
+	}
+
+	h, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("can't open local file %s: %w", localPath, err)
+	}
+	defer h.Close()
+
+	info, err := h.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat local file %s: %w", localPath, err)
+	}
+
+	tempPath := c.resolve(TempPath(remotePath))
+	if cpErr := c.write(tempPath, h, info); cpErr != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("can't upload file to %s: %w", remotePath, cpErr)
+	}
+	c.preserve(ctx, tempPath, remotePath, info)
+
+	if rnErr := os.Rename(tempPath, c.resolve(remotePath)); rnErr != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("can't rename %s to %s: %w", tempPath, remotePath, rnErr)
+	}
+
+	return nil
+}
+
+func (c *FileClient) write(target string, r io.Reader, info os.FileInfo) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("can't create file: %w", err)
+	}
+
+	if _, cpErr := io.Copy(f, r); cpErr != nil {
+		_ = f.Close()
+		return cpErr //nolint:wrapcheck // wrapped by the caller
+	}
+
+	return f.Close() //nolint:wrapcheck // wrapped by the caller
+}
+
+// preserve copies the permissions and the modification time of the source.
+// Some network shares don't support them, so failures are only logged.
+func (c *FileClient) preserve(ctx context.Context, target, remotePath string, info os.FileInfo) {
+	// the mode of a new file is masked by umask
+	err := os.Chmod(target, info.Mode().Perm())
+	if err == nil {
+		err = os.Chtimes(target, time.Time{}, info.ModTime())
+	}
+	if err != nil {
+		c.logger.Debug(ctx, "Failed to preserve attributes", logger.Fields{
+			"path":  remotePath,
+			"error": err,
+		})
+	}
+}
+
+func (c *FileClient) RemoveFile(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	err := os.Remove(c.resolve(remotePath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove file %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+func (c *FileClient) Remove(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(c.resolve(remotePath)); err != nil {
+		return fmt.Errorf("can't remove %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+func (c *FileClient) Rename(ctx context.Context, fromPath, toPath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	// the target must be kept if the source is missing
+	if _, err := c.Stat(ctx, fromPath); err != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, err)
+	}
+
+	dir, _ := path.Split(toPath)
+	if err := c.MakeDir(ctx, dir); err != nil {
+		return err
+	}
+
+	// a file replaces the target, but a directory can't replace a non-empty one
+	err := os.Rename(c.resolve(fromPath), c.resolve(toPath))
+	if err == nil {
+		return nil
+	}
+
+	if rmErr := c.Remove(ctx, toPath); rmErr != nil {
+		return rmErr
+	}
+	if rnErr := os.Rename(c.resolve(fromPath), c.resolve(toPath)); rnErr != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, rnErr)
+	}
+
+	return nil
+}
+
+func (c *FileClient) Stat(ctx context.Context, remotePath string) (Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return Entry{}, err
+	}
+
+	info, err := os.Lstat(c.resolve(remotePath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, remotePath)
+		}
+		return Entry{}, fmt.Errorf("can't stat %s: %w", remotePath, err)
+	}
+
+	return fileInfoEntry(info), nil
+}
+
+func (c *FileClient) List(ctx context.Context, remoteDir string) ([]Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(c.resolve(remoteDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can't list directory %s: %w", remoteDir, err)
+	}
+
+	result := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		info, infoErr := entry.Info()
+		if errors.Is(infoErr, os.ErrNotExist) {
+			// removed meanwhile
+			continue
+		}
+		if infoErr != nil {
+			return nil, fmt.Errorf("can't stat %s: %w", path.Join(remoteDir, entry.Name()), infoErr)
+		}
+		result = append(result, fileInfoEntry(info))
+	}
+
+	return result, nil
+}
+
+// Hash computes the SHA-256 checksum of the file, which is as cheap as for
+// the local file.
+func (c *FileClient) Hash(ctx context.Context, remotePath string) (Checksum, error) {
+	if err := c.init(ctx); err != nil {
+		return Checksum{}, err
+	}
+
+	f, err := os.Open(c.resolve(remotePath))
+	if err != nil {
+		return Checksum{}, fmt.Errorf("can't open %s: %w", remotePath, err)
+	}
+	defer f.Close()
+
+	h, err := NewHash(HashSHA256)
+	if err != nil {
+		return Checksum{}, err
+	}
+	if _, cpErr := io.Copy(h, f); cpErr != nil {
+		return Checksum{}, fmt.Errorf("can't read %s: %w", remotePath, cpErr)
+	}
+
+	return Checksum{Algorithm: HashSHA256, Value: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// PreservesModTime reports true, the times are copied after writing.
+func (c *FileClient) PreservesModTime(_ context.Context) (bool, error) {
+	return true, nil
+}
+
+func (c *FileClient) resolve(remotePath string) string {
+	return filepath.Join(c.root, filepath.FromSlash(remotePath))
+}
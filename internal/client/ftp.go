@@ -2,36 +2,60 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/textproto"
 	"net/url"
 	"os"
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	logger "github.com/go-core-fx/cli-logger"
 	"github.com/jlaffaye/ftp"
 	"github.com/samber/lo"
 )
 
+const (
+	ftpDefaultPort  = "21"
+	ftpsDefaultPort = "990"
+)
+
 type FtpClient struct {
-	url string
+	url     string
+	options TLSOptions
+	upload  UploadOptions
 
 	logger logger.Logger
 
 	client *ftp.ServerConn
 	lock   sync.Mutex
+	// setTime is whether the server supports MFMT
+	setTime bool
+
+	hasher          *ftpHasher
+	hashUnsupported bool
+	hashLock        sync.Mutex
 }
 
-func NewFtpClient(url string, logger logger.Logger) *FtpClient {
+func NewFtpClient(url string, options TLSOptions, upload UploadOptions, logger logger.Logger) *FtpClient {
 	return &FtpClient{
-		url: url,
+		url:     url,
+		options: options,
+		upload:  upload,
 
 		logger: logger,
 
-		client: nil,
-		lock:   sync.Mutex{},
+		client:  nil,
+		lock:    sync.Mutex{},
+		setTime: false,
+
+		hasher:          nil,
+		hashUnsupported: false,
+		hashLock:        sync.Mutex{},
 	}
 }
 
@@ -58,13 +82,14 @@ func (c *FtpClient) init(ctx context.Context) error {
 		return fmt.Errorf("can't parse URL: %w", err)
 	}
 
-	if u.Scheme != "ftp" {
-		return fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+	endpoint, err := c.endpoint(u)
+	if err != nil {
+		return err
 	}
 
-	c.client, err = ftp.Dial(u.Host, ftp.DialWithContext(ctx))
+	c.client, err = ftp.Dial(endpoint.host, endpoint.dialOptions(ctx)...)
 	if err != nil {
-		return fmt.Errorf("can't connect to %s: %w", u.Host, err)
+		return fmt.Errorf("can't connect to %s: %w: %w", endpoint.host, ErrUnreachable, err)
 	}
 
 	password, ok := u.User.Password()
@@ -80,9 +105,72 @@ func (c *FtpClient) init(ctx context.Context) error {
 		return fmt.Errorf("can't change directory to %s: %w", u.Path, chErr)
 	}
 
+	// the features are requested with FEAT on login
+	c.setTime = c.client.IsSetTimeSupported()
+	if !c.setTime {
+		c.logger.Debug(ctx, "Server doesn't support MFMT, modification times aren't preserved", logger.Fields{
+			"host": endpoint.host,
+		})
+	}
+
 	return nil
 }
 
+// ftpEndpoint describes how to reach the server.
+type ftpEndpoint struct {
+	host        string
+	tls         *tls.Config
+	explicitTLS bool
+}
+
+// endpoint selects the connection mode by the URL scheme: plain FTP, FTPS
+// with implicit TLS or FTPES with explicit AUTH TLS.
+func (c *FtpClient) endpoint(u *url.URL) (ftpEndpoint, error) {
+	endpoint := ftpEndpoint{
+		host:        u.Host,
+		tls:         nil,
+		explicitTLS: false,
+	}
+
+	port := ftpDefaultPort
+	switch u.Scheme {
+	case "ftp":
+	case "ftps", "ftpes":
+		if u.Scheme == "ftps" {
+			port = ftpsDefaultPort
+		}
+
+		config, err := tlsConfig(c.options, u.Hostname())
+		if err != nil {
+			return endpoint, err
+		}
+		endpoint.tls = config
+		endpoint.explicitTLS = u.Scheme == "ftpes"
+	default:
+		return endpoint, fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	if u.Port() == "" {
+		endpoint.host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return endpoint, nil
+}
+
+func (e ftpEndpoint) dialOptions(ctx context.Context) []ftp.DialOption {
+	options := []ftp.DialOption{ftp.DialWithContext(ctx)}
+
+	if e.tls == nil {
+		return options
+	}
+
+	if e.explicitTLS {
+		return append(options, ftp.DialWithExplicitTLS(e.tls))
+	}
+
+	return append(options, ftp.DialWithTLS(e.tls))
+}
+
 func (c *FtpClient) ping(_ context.Context) error {
 	if c.client == nil {
 		return ErrClientIsNil
@@ -149,13 +237,70 @@ func (c *FtpClient) UploadFile(ctx context.Context, remotePath string, localPath
 	}
 	defer h.Close()
 
-	if stErr := c.client.Stor(remotePath, h); stErr != nil {
+	info, err := h.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat local file %s: %w", localPath, err)
+	}
+
+	target := remotePath
+	if c.upload.Atomic {
+		target = TempPath(remotePath)
+	}
+
+	if stErr := c.client.Stor(target, h); stErr != nil {
+		if c.upload.Atomic {
+			_ = c.client.Delete(target)
+		}
 		return fmt.Errorf("can't upload file to %s: %w", remotePath, stErr)
 	}
+	c.setModTime(ctx, target, remotePath, info.ModTime())
+
+	if c.upload.Atomic {
+		return c.replace(target, remotePath)
+	}
 
 	return nil
 }
 
+// PreservesModTime reports whether the server supports MFMT, it connects to
+// the server if needed.
+func (c *FtpClient) PreservesModTime(ctx context.Context) (bool, error) {
+	if err := c.init(ctx); err != nil {
+		return false, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.setTime, nil
+}
+
+// setModTime copies the modification time of the local file with MFMT, so it
+// isn't the time of the upload. It's skipped if the server doesn't support
+// it, and failures are only logged.
+func (c *FtpClient) setModTime(ctx context.Context, target, remotePath string, modTime time.Time) {
+	if !c.setTime {
+		return
+	}
+
+	if err := c.client.SetTime(target, modTime); err != nil {
+		c.logger.Debug(ctx, "Failed to preserve modification time", logger.Fields{
+			"path":  remotePath,
+			"error": err,
+		})
+	}
+}
+
+// replace renames the uploaded temporary file over the target. Servers which
+// refuse to overwrite on rename get the target moved aside first.
+func (c *FtpClient) replace(tempPath, remotePath string) error {
+	if err := c.client.Rename(tempPath, remotePath); err == nil {
+		return nil
+	}
+
+	return replaceViaBackup(tempPath, remotePath, c.client.Rename, c.client.Delete)
+}
+
 func (c *FtpClient) RemoveFile(ctx context.Context, remotePath string) error {
 	if err := c.init(ctx); err != nil {
 		return err
@@ -170,30 +315,169 @@ func (c *FtpClient) RemoveFile(ctx context.Context, remotePath string) error {
 }
 
 func (c *FtpClient) Remove(ctx context.Context, remotePath string) error {
+	entry, err := c.Stat(ctx, remotePath)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Type == EntryTypeDir {
+		return c.RemoveDir(ctx, remotePath)
+	}
+
+	return c.RemoveFile(ctx, remotePath)
+}
+
+func (c *FtpClient) Rename(ctx context.Context, fromPath, toPath string) error {
 	if err := c.init(ctx); err != nil {
 		return err
 	}
 
+	dir, _ := path.Split(toPath)
+	if err := c.MakeDir(ctx, dir); err != nil {
+		return err
+	}
+
+	err := c.client.Rename(fromPath, toPath)
+	if err == nil {
+		return nil
+	}
+
+	// some servers refuse to overwrite, but the target must be kept if the
+	// source is missing
+	if _, stErr := c.Stat(ctx, fromPath); stErr != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, stErr)
+	}
+	if rmErr := c.Remove(ctx, toPath); rmErr != nil {
+		return rmErr
+	}
+	if rnErr := c.client.Rename(fromPath, toPath); rnErr != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, rnErr)
+	}
+
+	return nil
+}
+
+func (c *FtpClient) Stat(ctx context.Context, remotePath string) (Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return Entry{}, err
+	}
+
+	entry, err := c.client.GetEntry(remotePath)
+	if err == nil {
+		result := ftpEntry(entry)
+		result.Name = path.Base(remotePath)
+		return result, nil
+	}
+	if isIgnorableError(err) {
+		return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, remotePath)
+	}
+
+	// MLST is not supported, so look the entry up in the parent directory
 	dir, name := path.Split(remotePath)
-	entries, err := c.client.List(dir)
+	entries, err := c.List(ctx, dir)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	for _, e := range entries {
+		if e.Name == name {
+			return e, nil
+		}
+	}
+
+	return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, remotePath)
+}
+
+func (c *FtpClient) List(ctx context.Context, remoteDir string) ([]Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return nil, err
+	}
+
+	entries, err := c.client.List(remoteDir)
 	if err != nil && !isIgnorableError(err) {
-		return fmt.Errorf("can't list directory %s: %w", dir, err)
+		return nil, fmt.Errorf("can't list directory %s: %w", remoteDir, err)
 	}
 
+	result := make([]Entry, 0, len(entries))
 	for _, entry := range entries {
-		if entry.Name != name {
+		if entry.Name == "." || entry.Name == ".." {
 			continue
 		}
 
-		if entry.Type == ftp.EntryTypeFolder {
-			return c.RemoveDir(ctx, remotePath)
+		result = append(result, ftpEntry(entry))
+	}
+
+	return result, nil
+}
+
+// Hash asks the server for the checksum with HASH, XSHA256, XSHA1, XMD5 or
+// XCRC, whichever is announced by FEAT.
+func (c *FtpClient) Hash(ctx context.Context, remotePath string) (Checksum, error) {
+	c.hashLock.Lock()
+	defer c.hashLock.Unlock()
+
+	if c.hashUnsupported {
+		return Checksum{}, ErrHashNotSupported
+	}
+
+	if c.hasher == nil {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			return Checksum{}, fmt.Errorf("can't parse URL: %w", err)
 		}
-		if entry.Type == ftp.EntryTypeFile {
-			return c.RemoveFile(ctx, remotePath)
+
+		endpoint, err := c.endpoint(u)
+		if err != nil {
+			return Checksum{}, err
+		}
+
+		c.hasher, err = dialFtpHasher(ctx, u, endpoint)
+		if errors.Is(err, ErrHashNotSupported) {
+			c.hashUnsupported = true
+		}
+		if err != nil {
+			return Checksum{}, err
 		}
 	}
 
-	return nil
+	sum, err := c.hasher.hash(remotePath)
+	if err != nil {
+		if _, ok := lo.ErrorsAs[*textproto.Error](err); !ok {
+			// the connection is broken, reconnect on the next call
+			c.hasher.close()
+			c.hasher = nil
+		}
+		return Checksum{}, fmt.Errorf("can't hash %s: %w", remotePath, err)
+	}
+
+	return sum, nil
+}
+
+func ftpEntry(entry *ftp.Entry) Entry {
+	var entryType EntryType
+	switch entry.Type {
+	case ftp.EntryTypeFolder:
+		entryType = EntryTypeDir
+	case ftp.EntryTypeLink:
+		entryType = EntryTypeLink
+	case ftp.EntryTypeFile:
+		entryType = EntryTypeFile
+	default:
+		// unknown types are listed as files, like the FTP library does
+		entryType = EntryTypeFile
+	}
+
+	return Entry{
+		Name:    entry.Name,
+		Type:    entryType,
+		Size:    int64(entry.Size), //nolint:gosec // file sizes fit into int64
+		ModTime: entry.Time,
+		// permissions are not exposed by the FTP library
+		Mode: 0,
+	}
 }
 
 func isIgnorableError(err error) bool {
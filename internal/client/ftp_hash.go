@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/samber/lo"
+)
+
+// ftpNegativeReply is the lowest code of transient and permanent negative
+// completion replies.
+const ftpNegativeReply = 400
+
+// ftpHashCommands lists checksum commands in the order of preference. HASH
+// is described in draft-bryan-ftpext-hash, the X-commands are widespread
+// non-standard extensions.
+//
+//nolint:gochecknoglobals // constant lookup table
+var ftpHashCommands = []struct {
+	command   string
+	algorithm HashAlgorithm
+}{
+	{command: "XSHA256", algorithm: HashSHA256},
+	{command: "XSHA1", algorithm: HashSHA1},
+	{command: "XMD5", algorithm: HashMD5},
+	{command: "XCRC", algorithm: HashCRC32},
+}
+
+//nolint:gochecknoglobals // constant lookup table
+var ftpHashAlgorithms = []struct {
+	name      string
+	algorithm HashAlgorithm
+}{
+	{name: "SHA-256", algorithm: HashSHA256},
+	{name: "SHA-1", algorithm: HashSHA1},
+	{name: "MD5", algorithm: HashMD5},
+	{name: "CRC32", algorithm: HashCRC32},
+}
+
+// ftpHasher requests checksums over a dedicated control connection, because
+// the FTP library doesn't allow sending custom commands.
+type ftpHasher struct {
+	conn *textproto.Conn
+
+	command   string
+	algorithm HashAlgorithm
+}
+
+func dialFtpHasher(ctx context.Context, u *url.URL, endpoint ftpEndpoint) (*ftpHasher, error) {
+	var netConn net.Conn
+	var err error
+	if endpoint.tls != nil && !endpoint.explicitTLS {
+		dialer := tls.Dialer{NetDialer: nil, Config: endpoint.tls}
+		netConn, err = dialer.DialContext(ctx, "tcp", endpoint.host)
+	} else {
+		dialer := net.Dialer{}
+		netConn, err = dialer.DialContext(ctx, "tcp", endpoint.host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't connect to %s: %w", endpoint.host, err)
+	}
+
+	h := &ftpHasher{
+		conn:      textproto.NewConn(netConn),
+		command:   "",
+		algorithm: "",
+	}
+
+	if hsErr := h.handshake(u, endpoint, netConn); hsErr != nil {
+		h.close()
+		return nil, hsErr
+	}
+
+	return h, nil
+}
+
+func (h *ftpHasher) handshake(u *url.URL, endpoint ftpEndpoint, netConn net.Conn) error {
+	if _, _, err := h.conn.ReadResponse(ftp.StatusReady); err != nil {
+		return fmt.Errorf("can't connect to %s: %w", endpoint.host, err)
+	}
+
+	if endpoint.tls != nil && endpoint.explicitTLS {
+		if _, _, err := h.cmd(ftp.StatusAuthOK, "AUTH TLS"); err != nil {
+			return fmt.Errorf("can't start TLS: %w", err)
+		}
+		h.conn = textproto.NewConn(tls.Client(netConn, endpoint.tls))
+	}
+
+	password, _ := u.User.Password()
+	code, _, err := h.cmd(-1, "USER %s", u.User.Username())
+	if err == nil && code == ftp.StatusUserOK {
+		_, _, err = h.cmd(ftp.StatusLoggedIn, "PASS %s", password)
+	}
+	if err != nil {
+		return fmt.Errorf("can't login as %s: %w", u.User.Username(), err)
+	}
+
+	if u.Path != "" {
+		if _, _, cwdErr := h.cmd(ftp.StatusRequestedFileActionOK, "CWD %s", u.Path); cwdErr != nil {
+			return fmt.Errorf("can't change directory to %s: %w", u.Path, cwdErr)
+		}
+	}
+
+	return h.negotiate()
+}
+
+// negotiate picks the best checksum command announced by FEAT.
+func (h *ftpHasher) negotiate() error {
+	code, message, err := h.cmd(-1, "FEAT")
+	if _, ok := lo.ErrorsAs[*textproto.Error](err); !ok && err != nil {
+		return fmt.Errorf("can't list features: %w", err)
+	}
+
+	features := map[string]string{}
+	if code == ftp.StatusSystem {
+		for _, line := range strings.Split(message, "\n") {
+			name, desc, _ := strings.Cut(strings.TrimSpace(line), " ")
+			features[strings.ToUpper(name)] = desc
+		}
+	}
+
+	if desc, ok := features["HASH"]; ok {
+		supported := strings.ToUpper(strings.ReplaceAll(desc, "*", ""))
+		for _, alg := range ftpHashAlgorithms {
+			if !strings.Contains(";"+supported+";", ";"+alg.name+";") {
+				continue
+			}
+			if _, _, optsErr := h.cmd(ftp.StatusCommandOK, "OPTS HASH %s", alg.name); optsErr != nil {
+				continue
+			}
+
+			h.command, h.algorithm = "HASH", alg.algorithm
+			return nil
+		}
+	}
+
+	for _, candidate := range ftpHashCommands {
+		if _, ok := features[candidate.command]; ok {
+			h.command, h.algorithm = candidate.command, candidate.algorithm
+			return nil
+		}
+	}
+
+	return ErrHashNotSupported
+}
+
+func (h *ftpHasher) hash(remotePath string) (Checksum, error) {
+	_, message, err := h.cmd(-1, "%s %s", h.command, remotePath)
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	// HASH replies with "<algorithm> <range> <hash> <path>", X-commands
+	// reply with the hash optionally followed by the path
+	fields := strings.Fields(message)
+	index := 0
+	if h.command == "HASH" {
+		index = 2
+	}
+	if len(fields) <= index {
+		return Checksum{}, fmt.Errorf("%w: unexpected %s reply %q", ErrHashNotSupported, h.command, message)
+	}
+
+	return Checksum{
+		Algorithm: h.algorithm,
+		Value:     strings.ToLower(fields[index]),
+	}, nil
+}
+
+// cmd sends the command and reads the reply. Any positive completion reply
+// is accepted when expectCode is negative.
+func (h *ftpHasher) cmd(expectCode int, format string, args ...any) (int, string, error) {
+	if _, err := h.conn.Cmd(format, args...); err != nil {
+		return 0, "", fmt.Errorf("can't send command: %w", err)
+	}
+
+	if expectCode < 0 {
+		code, message, err := h.conn.ReadResponse(0)
+		if err != nil {
+			return code, message, fmt.Errorf("can't read reply: %w", err)
+		}
+		if code >= ftpNegativeReply {
+			return code, message, &textproto.Error{Code: code, Msg: message}
+		}
+		return code, message, nil
+	}
+
+	code, message, err := h.conn.ReadResponse(expectCode)
+	if err != nil {
+		return code, message, fmt.Errorf("can't read reply: %w", err)
+	}
+
+	return code, message, nil
+}
+
+func (h *ftpHasher) close() {
+	_, _ = h.conn.Cmd("QUIT")
+	_ = h.conn.Close()
+}
@@ -0,0 +1,143 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/client/clienttest"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+func newFtpClient(address string) *client.FtpClient {
+	return client.NewFtpClient(address, client.TLSOptions{}, client.UploadOptions{Atomic: true}, logger.NewDefault())
+}
+
+func writeLocal(t *testing.T, name, content string) string {
+	t.Helper()
+
+	localPath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(localPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return localPath
+}
+
+func TestFtpClientUploadsAtomically(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server := clienttest.NewFTPServer(t)
+	c := newFtpClient(server.URL())
+
+	localPath := writeLocal(t, "index.html", "hello")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UploadFile(ctx, "a/b/index.html", localPath); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(server.Root(), "a", "b", "index.html"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("got %q, %v, want %q", data, err, "hello")
+	}
+
+	// the modification time is set with MFMT
+	entry, err := c.Stat(ctx, "a/b/index.html")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if !entry.ModTime.Equal(modTime) {
+		t.Fatalf("got modification time %v, want %v", entry.ModTime, modTime)
+	}
+
+	entries, err := c.List(ctx, "a/b")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "index.html" || entries[0].Size != 5 {
+		t.Fatalf("got %+v, want only index.html without temporary files", entries)
+	}
+
+	if _, stErr := c.Stat(ctx, "a/missing"); !errors.Is(stErr, client.ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", stErr)
+	}
+}
+
+func TestFtpClientReplacesWithoutOverwrite(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server := clienttest.NewFTPServer(t)
+	server.RefuseOverwrite()
+	c := newFtpClient(server.URL())
+
+	for _, content := range []string{"old", "new"} {
+		if err := c.UploadFile(ctx, "index.html", writeLocal(t, "index.html", content)); err != nil {
+			t.Fatalf("UploadFile: %v", err)
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(server.Root(), "index.html")); err != nil || string(data) != "new" {
+		t.Fatalf("got %q, %v, want %q", data, err, "new")
+	}
+	entries, err := c.List(ctx, ".")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %+v, want only index.html without temporary or backup files", entries)
+	}
+}
+
+func TestFtpClientReconnects(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server := clienttest.NewFTPServer(t)
+	c := newFtpClient(server.URL())
+
+	if err := c.MakeDir(ctx, "before"); err != nil {
+		t.Fatalf("MakeDir: %v", err)
+	}
+
+	server.Disconnect()
+
+	// the broken connection is detected by the ping and replaced
+	if err := c.MakeDir(ctx, "after"); err != nil {
+		t.Fatalf("MakeDir after disconnect: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(server.Root(), "after")); err != nil {
+		t.Fatalf("directory wasn't created: %v", err)
+	}
+}
+
+func TestFtpClientUnreachable(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server := clienttest.NewFTPServer(t)
+	address := server.URL()
+	server.Close()
+
+	_, err := newFtpClient(address).Stat(ctx, ".")
+	if !client.IsUnreachable(err) {
+		t.Fatalf("got %v, want an unreachable error", err)
+	}
+}
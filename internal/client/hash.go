@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"crypto/md5"  //nolint:gosec // used for integrity checks only
+	"crypto/sha1" //nolint:gosec // used for integrity checks only
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc32"
+)
+
+const (
+	HashSHA256 HashAlgorithm = "sha256"
+	HashSHA1   HashAlgorithm = "sha1"
+	HashMD5    HashAlgorithm = "md5"
+	HashCRC32  HashAlgorithm = "crc32"
+)
+
+type HashAlgorithm string
+
+// Checksum is a hex-encoded digest of a file.
+type Checksum struct {
+	Algorithm HashAlgorithm
+	Value     string
+}
+
+// Hasher is implemented by backends able to provide checksums of remote
+// files without downloading them.
+type Hasher interface {
+	// Hash returns the checksum of the remote file with the algorithm chosen
+	// by the backend or ErrHashNotSupported if the server can't compute it.
+	Hash(ctx context.Context, remotePath string) (Checksum, error)
+}
+
+// NewHash returns the hash function of the algorithm.
+func NewHash(algorithm HashAlgorithm) (hash.Hash, error) {
+	switch algorithm {
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA1:
+		return sha1.New(), nil //nolint:gosec // used for integrity checks only
+	case HashMD5:
+		return md5.New(), nil //nolint:gosec // used for integrity checks only
+	case HashCRC32:
+		return crc32.NewIEEE(), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrHashNotSupported, algorithm)
+}
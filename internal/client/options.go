@@ -0,0 +1,55 @@
+package client
+
+// Options holds backend-specific settings that can't be expressed in the
+// destination URL.
+type Options struct {
+	SSH    SSHOptions
+	TLS    TLSOptions
+	S3     S3Options
+	Upload UploadOptions
+}
+
+// SSHOptions configures authentication and host key verification of the
+// SFTP backend.
+type SSHOptions struct {
+	// KeyFiles is a list of private key files used for public key authentication.
+	KeyFiles []string
+	// KeyPassphrase decrypts encrypted private keys.
+	KeyPassphrase string
+	// UseAgent enables authentication via ssh-agent available at SSH_AUTH_SOCK.
+	UseAgent bool
+	// KnownHostsFile is a path to the known_hosts file, ~/.ssh/known_hosts by default.
+	KnownHostsFile string
+	// AcceptNewHostKeys adds keys of unknown hosts to KnownHostsFile instead
+	// of rejecting them. Changed keys are rejected regardless.
+	AcceptNewHostKeys bool
+}
+
+// TLSOptions configures the TLS connection of the FTPS backend.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of certificate authorities trusted in addition to
+	// the system pool.
+	CAFile string
+	// CertFile and KeyFile hold the client certificate and its private key.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables verification of the server certificate.
+	InsecureSkipVerify bool
+}
+
+// S3Options configures the S3 backend.
+type S3Options struct {
+	// Endpoint is the host of an S3-compatible service, e.g. MinIO, with an
+	// optional http:// or https:// scheme. Amazon S3 is used by default.
+	Endpoint string
+	// Region is the region of the bucket, detected by the service if empty.
+	Region string
+}
+
+// UploadOptions controls how files are written to the remote.
+type UploadOptions struct {
+	// Atomic uploads files to a temporary name in the same directory and
+	// renames it over the target only after the transfer completes, so a
+	// partially written file is never visible under its final name.
+	Atomic bool
+}
@@ -0,0 +1,500 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/go-core-fx/cli-logger"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	s3DefaultEndpoint = "s3.amazonaws.com"
+	// s3MaxRetries limits the retries of the library, the syncer retries
+	// failed paths itself and an unreachable server should be detected soon.
+	s3MaxRetries = 3
+	// s3DirContentType marks objects which represent empty directories.
+	s3DirContentType = "application/x-directory"
+	// s3DefaultContentType is used for files with an unknown extension.
+	s3DefaultContentType = "application/octet-stream"
+	// md5HexLength is the length of a hex-encoded MD5 checksum.
+	md5HexLength = 32
+	// s3MtimeMetadata keeps the modification time of the local file as Unix
+	// seconds with a fraction, the same way rclone does.
+	s3MtimeMetadata = "Mtime"
+)
+
+// S3Client stores files as objects of a bucket, under the prefix given by the
+// path of the URL. Directories are implied by the keys of their objects,
+// MakeDir puts a marker object, so empty directories exist too.
+//
+// An object becomes visible only when its upload is completed, so uploads are
+// always atomic. Files larger than 16 MiB are uploaded in parts.
+type S3Client struct {
+	url     string
+	options S3Options
+	tls     TLSOptions
+
+	logger logger.Logger
+
+	client *minio.Client
+	bucket string
+	prefix string
+	lock   sync.Mutex
+}
+
+func NewS3Client(url string, options S3Options, tls TLSOptions, logger logger.Logger) *S3Client {
+	return &S3Client{
+		url:     url,
+		options: options,
+		tls:     tls,
+
+		logger: logger,
+
+		client: nil,
+		bucket: "",
+		prefix: "",
+		lock:   sync.Mutex{},
+	}
+}
+
+// init creates the client and checks the bucket once. Requests are
+// stateless, so there is no connection to keep alive.
+func (c *S3Client) init(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.client != nil {
+		return nil
+	}
+
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return fmt.Errorf("can't parse URL: %w", err)
+	}
+
+	if u.Scheme != "s3" {
+		return fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	host, secure, err := c.endpoint()
+	if err != nil {
+		return err
+	}
+
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return fmt.Errorf("can't create transport: %w", err)
+	}
+	if secure {
+		config, tlsErr := tlsConfig(c.tls, "")
+		if tlsErr != nil {
+			return tlsErr
+		}
+		transport.TLSClientConfig = config
+	}
+
+	client, err := minio.New(host, &minio.Options{
+		Creds:      s3Credentials(u),
+		Secure:     secure,
+		Transport:  transport,
+		Region:     c.options.Region,
+		MaxRetries: s3MaxRetries,
+	})
+	if err != nil {
+		return fmt.Errorf("can't create client for %s: %w", host, err)
+	}
+
+	bucket := u.Host
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %w", host, markUnreachable(err))
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucket)
+	}
+
+	c.client = client
+	c.bucket = bucket
+	c.prefix = strings.Trim(u.Path, "/")
+
+	c.logger.Debug(ctx, "Connected to bucket", logger.Fields{
+		"endpoint": host,
+		"bucket":   bucket,
+	})
+
+	return nil
+}
+
+// endpoint returns the host of the service and whether to use HTTPS. The
+// scheme of a custom endpoint selects the protocol, HTTPS by default.
+func (c *S3Client) endpoint() (string, bool, error) {
+	endpoint := c.options.Endpoint
+	if endpoint == "" {
+		return s3DefaultEndpoint, true, nil
+	}
+
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, true, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("can't parse endpoint: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		return u.Host, false, nil
+	case "https":
+		return u.Host, true, nil
+	}
+
+	return "", false, fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+}
+
+// s3Credentials uses the access key and the secret key of the URL, if any,
+// or the usual environment variables, credentials file and IAM role.
+func s3Credentials(u *url.URL) *credentials.Credentials {
+	if u.User != nil {
+		secret, _ := u.User.Password()
+		return credentials.NewStaticV4(u.User.Username(), secret, "")
+	}
+
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+	})
+}
+
+func (c *S3Client) MakeDir(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	prefix := c.dirPrefix(remotePath)
+	if prefix == "" {
+		// root path
+		return nil
+	}
+
+	// the streaming signature of plain HTTP requests drops Content-Length
+	// of an empty body, which some servers require, and there is nothing to
+	// sign anyway
+	_, err := c.client.PutObject(ctx, c.bucket, prefix, bytes.NewReader(nil), 0, minio.PutObjectOptions{
+		ContentType:          s3DirContentType,
+		DisableContentSha256: true,
+	})
+	if err != nil {
+		return fmt.Errorf("can't make directory %s: %w", remotePath, markUnreachable(err))
+	}
+
+	return nil
+}
+
+func (c *S3Client) RemoveDir(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var listErr error
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+
+		for object := range c.client.ListObjects(ctx, c.bucket, minio.ListObjectsOptions{
+			Prefix:    c.dirPrefix(remotePath),
+			Recursive: true,
+		}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			objects <- object
+		}
+	}()
+
+	var err error
+	for rmErr := range c.client.RemoveObjects(ctx, c.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if err == nil {
+			err = rmErr.Err
+		}
+	}
+	if err == nil {
+		err = listErr
+	}
+	if err != nil {
+		return fmt.Errorf("can't remove directory %s: %w", remotePath, markUnreachable(err))
+	}
+
+	return nil
+}
+
+func (c *S3Client) UploadFile(ctx context.Context, remotePath string, localPath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	h, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("can't open local file %s: %w", localPath, err)
+	}
+	defer h.Close()
+
+	info, err := h.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat local file %s: %w", localPath, err)
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(remotePath))
+	if contentType == "" {
+		contentType = s3DefaultContentType
+	}
+
+	_, err = c.client.PutObject(ctx, c.bucket, c.key(remotePath), h, info.Size(), minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: map[string]string{s3MtimeMetadata: formatMtime(info.ModTime())},
+	})
+	if err != nil {
+		return fmt.Errorf("can't upload file to %s: %w", remotePath, markUnreachable(err))
+	}
+
+	return nil
+}
+
+func (c *S3Client) RemoveFile(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	// removal of a missing object succeeds
+	if err := c.client.RemoveObject(ctx, c.bucket, c.key(remotePath), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove file %s: %w", remotePath, markUnreachable(err))
+	}
+
+	return nil
+}
+
+func (c *S3Client) Remove(ctx context.Context, remotePath string) error {
+	entry, err := c.Stat(ctx, remotePath)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Type == EntryTypeDir {
+		return c.RemoveDir(ctx, remotePath)
+	}
+
+	return c.RemoveFile(ctx, remotePath)
+}
+
+// Rename copies the objects to the new keys and removes the old ones, as
+// there is no rename in S3. Parents don't need to be created.
+func (c *S3Client) Rename(ctx context.Context, fromPath, toPath string) error {
+	// the target must be kept if the source is missing
+	entry, err := c.Stat(ctx, fromPath)
+	if err != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, err)
+	}
+	if rmErr := c.Remove(ctx, toPath); rmErr != nil {
+		return rmErr
+	}
+
+	if entry.Type != EntryTypeDir {
+		return c.move(ctx, c.key(fromPath), c.key(toPath))
+	}
+
+	fromPrefix, toPrefix := c.dirPrefix(fromPath), c.dirPrefix(toPath)
+
+	var keys []string
+	for object := range c.client.ListObjects(ctx, c.bucket, minio.ListObjectsOptions{
+		Prefix:    fromPrefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, markUnreachable(object.Err))
+		}
+		keys = append(keys, object.Key)
+	}
+
+	for _, key := range keys {
+		if mvErr := c.move(ctx, key, toPrefix+strings.TrimPrefix(key, fromPrefix)); mvErr != nil {
+			return mvErr
+		}
+	}
+
+	return nil
+}
+
+func (c *S3Client) move(ctx context.Context, fromKey, toKey string) error {
+	_, err := c.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: c.bucket, Object: toKey},
+		minio.CopySrcOptions{Bucket: c.bucket, Object: fromKey},
+	)
+	if err != nil {
+		return fmt.Errorf("can't copy %s to %s: %w", fromKey, toKey, markUnreachable(err))
+	}
+
+	if rmErr := c.client.RemoveObject(ctx, c.bucket, fromKey, minio.RemoveObjectOptions{}); rmErr != nil {
+		return fmt.Errorf("can't remove %s: %w", fromKey, markUnreachable(rmErr))
+	}
+
+	return nil
+}
+
+// Stat returns the object of the file or the directory implied by the keys
+// with its prefix.
+func (c *S3Client) Stat(ctx context.Context, remotePath string) (Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return Entry{}, err
+	}
+
+	key := c.key(remotePath)
+	if key == "" {
+		// the root always exists, but it's still a request to the server
+		if _, err := c.client.BucketExists(ctx, c.bucket); err != nil {
+			return Entry{}, fmt.Errorf("can't stat %s: %w", remotePath, markUnreachable(err))
+		}
+		return s3DirEntry(path.Base(c.prefix)), nil
+	}
+
+	info, err := c.client.StatObject(ctx, c.bucket, key, minio.StatObjectOptions{})
+	if err == nil {
+		return s3Entry(path.Base(key), info), nil
+	}
+	if minio.ToErrorResponse(err).Code != minio.NoSuchKey {
+		return Entry{}, fmt.Errorf("can't stat %s: %w", remotePath, markUnreachable(err))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range c.client.ListObjects(ctx, c.bucket, minio.ListObjectsOptions{
+		Prefix:  key + "/",
+		MaxKeys: 1,
+	}) {
+		if object.Err != nil {
+			return Entry{}, fmt.Errorf("can't stat %s: %w", remotePath, markUnreachable(object.Err))
+		}
+		return s3DirEntry(path.Base(key)), nil
+	}
+
+	return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, remotePath)
+}
+
+func (c *S3Client) List(ctx context.Context, remoteDir string) ([]Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return nil, err
+	}
+
+	prefix := c.dirPrefix(remoteDir)
+
+	var result []Entry
+	for object := range c.client.ListObjects(ctx, c.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: false,
+	}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("can't list directory %s: %w", remoteDir, markUnreachable(object.Err))
+		}
+
+		name := strings.TrimPrefix(object.Key, prefix)
+		switch {
+		case name == "":
+			// the marker of the directory itself
+			continue
+		case strings.HasSuffix(name, "/"):
+			result = append(result, s3DirEntry(strings.TrimSuffix(name, "/")))
+		default:
+			result = append(result, s3Entry(name, object))
+		}
+	}
+
+	return result, nil
+}
+
+// Hash returns the ETag of the object, which is the MD5 checksum of objects
+// uploaded in a single part.
+func (c *S3Client) Hash(ctx context.Context, remotePath string) (Checksum, error) {
+	if err := c.init(ctx); err != nil {
+		return Checksum{}, err
+	}
+
+	info, err := c.client.StatObject(ctx, c.bucket, c.key(remotePath), minio.StatObjectOptions{})
+	if err != nil {
+		return Checksum{}, fmt.Errorf("can't stat %s: %w", remotePath, markUnreachable(err))
+	}
+
+	etag := strings.ToLower(strings.Trim(info.ETag, `"`))
+	if len(etag) != md5HexLength || strings.Contains(etag, "-") {
+		// multipart uploads and encrypted objects have other ETags
+		return Checksum{}, fmt.Errorf("%w: %s", ErrHashNotSupported, remotePath)
+	}
+
+	return Checksum{Algorithm: HashMD5, Value: etag}, nil
+}
+
+func (c *S3Client) key(remotePath string) string {
+	key := path.Join(c.prefix, remotePath)
+	if key == "." {
+		return ""
+	}
+
+	return strings.TrimPrefix(key, "/")
+}
+
+// dirPrefix returns the common prefix of the keys within the directory.
+func (c *S3Client) dirPrefix(remotePath string) string {
+	if key := c.key(remotePath); key != "" {
+		return key + "/"
+	}
+
+	return ""
+}
+
+// s3Entry converts the object. Listings don't include the metadata, so the
+// time of the upload is reported both by List and Stat, and the local time
+// kept in the metadata doesn't take part in comparisons. The time is
+// truncated to the second, the precision of the Last-Modified header.
+func s3Entry(name string, info minio.ObjectInfo) Entry {
+	return Entry{
+		Name:    name,
+		Type:    EntryTypeFile,
+		Size:    info.Size,
+		ModTime: info.LastModified.Truncate(time.Second),
+		Mode:    0,
+	}
+}
+
+func formatMtime(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+func s3DirEntry(name string) Entry {
+	return Entry{
+		Name:    name,
+		Type:    EntryTypeDir,
+		Size:    0,
+		ModTime: time.Time{},
+		Mode:    0,
+	}
+}
@@ -0,0 +1,59 @@
+package client_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/client/clienttest"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+func TestS3ClientReportsConsistentTimes(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	server := clienttest.NewS3Server(t)
+	c := client.NewS3Client(
+		server.URL(),
+		client.S3Options{Endpoint: server.Endpoint(), Region: "us-east-1"},
+		client.TLSOptions{},
+		logger.NewDefault(),
+	)
+
+	localPath := writeLocal(t, "index.html", "hello")
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(localPath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UploadFile(ctx, "index.html", localPath); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	entries, err := c.List(ctx, ".")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+
+	entry, err := c.Stat(ctx, "index.html")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	// listings don't include the metadata, so both report the upload time
+	if entry.Size != entries[0].Size || !entry.ModTime.Equal(entries[0].ModTime) {
+		t.Errorf("Stat returned %d bytes at %v, List returned %d bytes at %v",
+			entry.Size, entry.ModTime, entries[0].Size, entries[0].ModTime)
+	}
+	if entry.ModTime.Equal(modTime) {
+		t.Errorf("got the local modification time %v, want the time of the upload", entry.ModTime)
+	}
+}
@@ -0,0 +1,386 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+
+	logger "github.com/go-core-fx/cli-logger"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sftpDefaultPort = "22"
+)
+
+type SftpClient struct {
+	url     string
+	options SSHOptions
+	upload  UploadOptions
+
+	logger logger.Logger
+
+	conn   *ssh.Client
+	client *sftp.Client
+	root   string
+	lock   sync.Mutex
+}
+
+func NewSftpClient(url string, options SSHOptions, upload UploadOptions, logger logger.Logger) *SftpClient {
+	return &SftpClient{
+		url:     url,
+		options: options,
+		upload:  upload,
+
+		logger: logger,
+
+		conn:   nil,
+		client: nil,
+		root:   "",
+		lock:   sync.Mutex{},
+	}
+}
+
+func (c *SftpClient) init(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.client != nil {
+		var err error
+		if err = c.ping(ctx); err == nil {
+			return nil
+		}
+
+		c.logger.Warn(ctx, "Reconnecting because of error", logger.Fields{
+			"error": err,
+		})
+
+		c.close()
+	}
+
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return fmt.Errorf("can't parse URL: %w", err)
+	}
+
+	if u.Scheme != "sftp" {
+		return fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), sftpDefaultPort)
+	}
+
+	password, ok := u.User.Password()
+	if !ok {
+		password = ""
+	}
+
+	auth, cleanup, err := sshAuthMethods(c.options, password)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	config := &ssh.ClientConfig{
+		User:            u.User.Username(),
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback(c.options),
+	}
+
+	dialer := net.Dialer{}
+	netConn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("can't connect to %s: %w: %w", host, ErrUnreachable, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, host, config)
+	if err != nil {
+		_ = netConn.Close()
+		if errors.Is(err, ErrHostKeyMismatch) || errors.Is(err, ErrHostKeyUnknown) {
+			return fmt.Errorf("can't verify host %s: %w", host, err)
+		}
+		return fmt.Errorf("can't login as %s: %w", u.User.Username(), err)
+	}
+	c.conn = ssh.NewClient(sshConn, chans, reqs)
+
+	c.client, err = sftp.NewClient(c.conn)
+	if err != nil {
+		c.close()
+		return fmt.Errorf("can't start sftp session: %w", err)
+	}
+
+	c.root = u.Path
+	if c.root == "" {
+		c.root = "."
+	}
+
+	if _, stErr := c.client.Stat(c.root); stErr != nil {
+		c.close()
+		return fmt.Errorf("can't change directory to %s: %w", u.Path, stErr)
+	}
+
+	return nil
+}
+
+func (c *SftpClient) ping(_ context.Context) error {
+	if c.client == nil {
+		return ErrClientIsNil
+	}
+
+	if _, err := c.client.Getwd(); err != nil {
+		return fmt.Errorf("failed to ping: %w", err)
+	}
+
+	return nil
+}
+
+func (c *SftpClient) close() {
+	if c.client != nil {
+		_ = c.client.Close()
+		c.client = nil
+	}
+
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *SftpClient) MakeDir(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	if remotePath == "" {
+		// root path
+		return nil
+	}
+
+	if err := c.client.MkdirAll(c.resolve(remotePath)); err != nil {
+		return fmt.Errorf("can't make directory %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+func (c *SftpClient) RemoveDir(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	if err := c.client.RemoveAll(c.resolve(remotePath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("can't remove directory %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+func (c *SftpClient) UploadFile(ctx context.Context, remotePath string, localPath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	dir, _ := path.Split(remotePath)
+	if err := c.MakeDir(ctx, dir); err != nil {
+		return err
+	}
+
+	h, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("can't open local file %s: %w", localPath, err)
+	}
+	defer h.Close()
+
+	info, err := h.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat local file %s: %w", localPath, err)
+	}
+
+	target := c.resolve(remotePath)
+	if c.upload.Atomic {
+		target = c.resolve(TempPath(remotePath))
+	}
+
+	if upErr := c.write(target, h); upErr != nil {
+		if c.upload.Atomic {
+			_ = c.client.Remove(target)
+		}
+		return fmt.Errorf("can't upload file to %s: %w", remotePath, upErr)
+	}
+
+	// the modification time is preserved by the rename, some servers don't
+	// allow to change it, so failures are only logged
+	if tmErr := c.client.Chtimes(target, info.ModTime(), info.ModTime()); tmErr != nil {
+		c.logger.Debug(ctx, "Failed to preserve modification time", logger.Fields{
+			"path":  remotePath,
+			"error": tmErr,
+		})
+	}
+
+	if c.upload.Atomic {
+		return c.replace(target, c.resolve(remotePath))
+	}
+
+	return nil
+}
+
+func (c *SftpClient) write(target string, r io.Reader) error {
+	f, err := c.client.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("can't create remote file: %w", err)
+	}
+
+	if _, cpErr := io.Copy(f, r); cpErr != nil {
+		_ = f.Close()
+		return cpErr //nolint:wrapcheck // wrapped by the caller
+	}
+
+	return f.Close() //nolint:wrapcheck // wrapped by the caller
+}
+
+// replace renames the uploaded temporary file over the target. The plain
+// SFTP rename fails if the target exists, so the atomic posix-rename
+// extension is preferred.
+func (c *SftpClient) replace(tempPath, target string) error {
+	if err := c.client.PosixRename(tempPath, target); err == nil {
+		return nil
+	}
+
+	return replaceViaBackup(tempPath, target, c.client.Rename, c.client.Remove)
+}
+
+func (c *SftpClient) RemoveFile(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	err := c.client.Remove(c.resolve(remotePath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove file %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+func (c *SftpClient) Remove(ctx context.Context, remotePath string) error {
+	entry, err := c.Stat(ctx, remotePath)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Type == EntryTypeDir {
+		return c.RemoveDir(ctx, remotePath)
+	}
+
+	return c.RemoveFile(ctx, remotePath)
+}
+
+func (c *SftpClient) Rename(ctx context.Context, fromPath, toPath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	dir, _ := path.Split(toPath)
+	if err := c.MakeDir(ctx, dir); err != nil {
+		return err
+	}
+
+	// the plain SFTP rename fails if the target exists
+	err := c.client.PosixRename(c.resolve(fromPath), c.resolve(toPath))
+	if err == nil {
+		return nil
+	}
+
+	// the target must be kept if the source is missing
+	if _, stErr := c.Stat(ctx, fromPath); stErr != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, stErr)
+	}
+	if rmErr := c.Remove(ctx, toPath); rmErr != nil {
+		return rmErr
+	}
+	if rnErr := c.client.Rename(c.resolve(fromPath), c.resolve(toPath)); rnErr != nil {
+		return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, rnErr)
+	}
+
+	return nil
+}
+
+func (c *SftpClient) Stat(ctx context.Context, remotePath string) (Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return Entry{}, err
+	}
+
+	info, err := c.client.Lstat(c.resolve(remotePath))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, remotePath)
+		}
+		return Entry{}, fmt.Errorf("can't stat %s: %w", remotePath, err)
+	}
+
+	return fileInfoEntry(info), nil
+}
+
+func (c *SftpClient) List(ctx context.Context, remoteDir string) ([]Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return nil, err
+	}
+
+	infos, err := c.client.ReadDirContext(ctx, c.resolve(remoteDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("can't list directory %s: %w", remoteDir, err)
+	}
+
+	result := make([]Entry, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, fileInfoEntry(info))
+	}
+
+	return result, nil
+}
+
+func fileInfoEntry(info os.FileInfo) Entry {
+	return Entry{
+		Name:    info.Name(),
+		Type:    fileModeEntryType(info.Mode()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Mode:    info.Mode().Perm(),
+	}
+}
+
+func fileModeEntryType(mode os.FileMode) EntryType {
+	switch {
+	case mode.IsDir():
+		return EntryTypeDir
+	case mode&os.ModeSymlink != 0:
+		return EntryTypeLink
+	default:
+		return EntryTypeFile
+	}
+}
+
+// PreservesModTime reports true, the times are set with Chtimes after the
+// upload. Servers refusing it report the upload time, which is newer.
+func (c *SftpClient) PreservesModTime(_ context.Context) (bool, error) {
+	return true, nil
+}
+
+func (c *SftpClient) resolve(remotePath string) string {
+	return path.Join(c.root, remotePath)
+}
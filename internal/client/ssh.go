@@ -0,0 +1,170 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/samber/lo"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultKnownHostsFile = "~/.ssh/known_hosts"
+
+	knownHostsPerm    = 0o600
+	knownHostsDirPerm = 0o700
+)
+
+// knownHostsLock serializes appends to known_hosts between clients.
+//
+//nolint:gochecknoglobals // shared by all SFTP clients of the process
+var knownHostsLock sync.Mutex
+
+// sshAuthMethods builds the list of authentication methods in the order they
+// are tried: ssh-agent, private key files and password from the URL.
+func sshAuthMethods(opts SSHOptions, password string) ([]ssh.AuthMethod, func(), error) {
+	methods := make([]ssh.AuthMethod, 0, 3) //nolint:mnd // agent, keys and password
+	cleanup := func() {}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); opts.UseAgent && sock != "" {
+		conn, err := (&net.Dialer{}).Dial("unix", sock)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("can't connect to ssh-agent: %w", err)
+		}
+		cleanup = func() { _ = conn.Close() }
+
+		methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+	}
+
+	if len(opts.KeyFiles) > 0 {
+		signers := make([]ssh.Signer, 0, len(opts.KeyFiles))
+		for _, keyFile := range opts.KeyFiles {
+			signer, err := loadPrivateKey(keyFile, opts.KeyPassphrase)
+			if err != nil {
+				cleanup()
+				return nil, func() {}, err
+			}
+			signers = append(signers, signer)
+		}
+
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if password != "" {
+		methods = append(methods, ssh.Password(password))
+	}
+
+	return methods, cleanup, nil
+}
+
+func loadPrivateKey(keyFile, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(expandHome(keyFile))
+	if err != nil {
+		return nil, fmt.Errorf("can't read private key %s: %w", keyFile, err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	if _, ok := lo.ErrorsAs[*ssh.PassphraseMissingError](err); ok {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%w: private key %s is encrypted", ErrPassphraseRequired, keyFile)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't parse private key %s: %w", keyFile, err)
+	}
+
+	return signer, nil
+}
+
+// hostKeyCallback verifies the server key against known_hosts. The file is
+// read on every call, so each reconnect is verified against its current
+// content.
+func hostKeyCallback(opts SSHOptions) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		file := opts.KnownHostsFile
+		if file == "" {
+			file = defaultKnownHostsFile
+		}
+		file = expandHome(file)
+
+		knownHostsLock.Lock()
+		defer knownHostsLock.Unlock()
+
+		err := checkKnownHosts(file, hostname, remote, key)
+		keyErr, ok := lo.ErrorsAs[*knownhosts.KeyError](err)
+		if !ok {
+			return err
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf(
+				"%w: %s presented %s key %s which doesn't match %s:%d",
+				ErrHostKeyMismatch, hostname, key.Type(), fingerprint, keyErr.Want[0].Filename, keyErr.Want[0].Line,
+			)
+		}
+
+		if !opts.AcceptNewHostKeys {
+			return fmt.Errorf("%w: %s with %s key %s is not in %s", ErrHostKeyUnknown, hostname, key.Type(), fingerprint, file)
+		}
+
+		return appendKnownHost(file, hostname, remote, key)
+	}
+}
+
+func checkKnownHosts(file, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return &knownhosts.KeyError{Want: nil}
+	}
+
+	callback, err := knownhosts.New(file)
+	if err != nil {
+		return fmt.Errorf("can't load known hosts from %s: %w", file, err)
+	}
+
+	return callback(hostname, remote, key) //nolint:wrapcheck // inspected by the caller
+}
+
+func appendKnownHost(file, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(file), knownHostsDirPerm); err != nil {
+		return fmt.Errorf("can't create directory for %s: %w", file, err)
+	}
+
+	h, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, knownHostsPerm)
+	if err != nil {
+		return fmt.Errorf("can't open %s: %w", file, err)
+	}
+	defer h.Close()
+
+	addresses := []string{knownhosts.Normalize(hostname)}
+	if remote != nil && remote.String() != hostname {
+		addresses = append(addresses, knownhosts.Normalize(remote.String()))
+	}
+
+	if _, wrErr := fmt.Fprintln(h, knownhosts.Line(addresses, key)); wrErr != nil {
+		return fmt.Errorf("can't write to %s: %w", file, wrErr)
+	}
+
+	return nil
+}
+
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(filepath.ToSlash(p), "~/") {
+		return p
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+
+	return filepath.Join(home, p[1:])
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// tempSuffix marks files being uploaded atomically.
+	tempSuffix = ".sftp-sync.tmp"
+	// backupSuffix marks targets moved aside while the temporary file is
+	// renamed over them. Unlike temporary files, they are never removed as
+	// leftovers, as they may be the only copy of the file.
+	backupSuffix = ".sftp-sync.bak"
+)
+
+// TimePreserver is implemented by backends able to keep the modification
+// time of uploaded files.
+type TimePreserver interface {
+	// PreservesModTime reports whether Stat and List return the modification
+	// time of the local file for uploaded files instead of the upload time.
+	PreservesModTime(ctx context.Context) (bool, error)
+}
+
+// TempPath returns the temporary path used by atomic uploads of the file.
+func TempPath(remotePath string) string {
+	dir, name := path.Split(remotePath)
+	return dir + "." + name + tempSuffix
+}
+
+// IsTempName reports whether the name is a temporary name of an atomic
+// upload, e.g. left behind by an interrupted transfer.
+func IsTempName(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempSuffix) && len(name) > len(tempSuffix)+1
+}
+
+// replaceViaBackup renames the temporary file over the target on servers
+// which refuse to overwrite on rename. The target is moved aside first and
+// restored if the final rename fails, so the remote always keeps one of the
+// versions. The temporary file is removed only while the target is in place.
+func replaceViaBackup(tempPath, target string, rename func(from, to string) error, remove func(string) error) error {
+	dir, name := path.Split(target)
+	backupPath := dir + "." + name + backupSuffix
+
+	if err := rename(target, backupPath); err != nil {
+		// the target may be missing, it's untouched either way
+		if rnErr := rename(tempPath, target); rnErr != nil {
+			_ = remove(tempPath)
+			return fmt.Errorf("can't rename %s to %s: %w", tempPath, target, rnErr)
+		}
+		return nil
+	}
+
+	if err := rename(tempPath, target); err != nil {
+		if rsErr := rename(backupPath, target); rsErr != nil {
+			return fmt.Errorf("can't rename %s to %s, the old file is kept as %s: %w", tempPath, target, backupPath, err)
+		}
+		_ = remove(tempPath)
+		return fmt.Errorf("can't rename %s to %s: %w", tempPath, target, err)
+	}
+
+	_ = remove(backupPath)
+
+	return nil
+}
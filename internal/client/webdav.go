@@ -0,0 +1,294 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+
+	logger "github.com/go-core-fx/cli-logger"
+	"github.com/studio-b12/gowebdav"
+)
+
+// WebdavClient syncs to a WebDAV server, e.g. Nextcloud or IIS. The URL
+// scheme selects HTTP (webdav) or HTTPS (webdavs), basic and digest
+// authentication are negotiated with the server.
+//
+// The library doesn't support contexts, so requests in progress aren't
+// interrupted on shutdown.
+type WebdavClient struct {
+	url     string
+	options TLSOptions
+	upload  UploadOptions
+
+	logger logger.Logger
+
+	client *gowebdav.Client
+	lock   sync.Mutex
+}
+
+func NewWebdavClient(url string, options TLSOptions, upload UploadOptions, logger logger.Logger) *WebdavClient {
+	return &WebdavClient{
+		url:     url,
+		options: options,
+		upload:  upload,
+
+		logger: logger,
+
+		client: nil,
+		lock:   sync.Mutex{},
+	}
+}
+
+// init creates the client and checks the credentials once. Requests are
+// stateless, so there is no connection to keep alive.
+func (c *WebdavClient) init(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.client != nil {
+		return nil
+	}
+
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return fmt.Errorf("can't parse URL: %w", err)
+	}
+
+	root := *u
+	root.User = nil
+	switch u.Scheme {
+	case "webdav":
+		root.Scheme = "http"
+	case "webdavs":
+		root.Scheme = "https"
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	password, ok := u.User.Password()
+	if !ok {
+		password = ""
+	}
+
+	client := gowebdav.NewClient(root.String(), u.User.Username(), password)
+	if root.Scheme == "https" {
+		config, tlsErr := tlsConfig(c.options, u.Hostname())
+		if tlsErr != nil {
+			return tlsErr
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // it is a transport
+		transport.TLSClientConfig = config
+		client.SetTransport(transport)
+	}
+
+	// the authentication method is negotiated by the first request
+	if connErr := client.Connect(); connErr != nil {
+		if gowebdav.IsErrCode(connErr, http.StatusUnauthorized) {
+			return fmt.Errorf("can't login as %s: %w", u.User.Username(), connErr)
+		}
+		return fmt.Errorf("can't connect to %s: %w", u.Host, markUnreachable(connErr))
+	}
+
+	c.client = client
+
+	c.logger.Debug(ctx, "Connected to server", logger.Fields{
+		"url": root.String(),
+	})
+
+	return nil
+}
+
+func (c *WebdavClient) MakeDir(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	if remotePath == "" {
+		// root path
+		return nil
+	}
+
+	err := c.client.MkdirAll(c.resolve(remotePath), 0)
+	if gowebdav.IsErrCode(err, http.StatusMethodNotAllowed) {
+		// MKCOL of an existing collection isn't allowed
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't make directory %s: %w", remotePath, markUnreachable(err))
+	}
+
+	return nil
+}
+
+func (c *WebdavClient) RemoveDir(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	// DELETE of a collection removes its members too
+	if err := c.client.RemoveAll(c.resolve(remotePath)); err != nil {
+		return fmt.Errorf("can't remove directory %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+func (c *WebdavClient) UploadFile(ctx context.Context, remotePath string, localPath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	h, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("can't open local file %s: %w", localPath, err)
+	}
+	defer h.Close()
+
+	info, err := h.Stat()
+	if err != nil {
+		return fmt.Errorf("can't stat local file %s: %w", localPath, err)
+	}
+
+	// missing parents are created by the library
+	target := c.resolve(remotePath)
+	if c.upload.Atomic {
+		target = c.resolve(TempPath(remotePath))
+	}
+
+	if upErr := c.client.WriteStreamWithLength(target, h, info.Size(), 0); upErr != nil {
+		if c.upload.Atomic {
+			_ = c.client.Remove(target)
+		}
+		return fmt.Errorf("can't upload file to %s: %w", remotePath, markUnreachable(upErr))
+	}
+
+	if c.upload.Atomic {
+		if rnErr := c.client.Rename(target, c.resolve(remotePath), true); rnErr != nil {
+			_ = c.client.Remove(target)
+			return fmt.Errorf("can't rename %s to %s: %w", target, remotePath, markUnreachable(rnErr))
+		}
+	}
+
+	return nil
+}
+
+func (c *WebdavClient) RemoveFile(ctx context.Context, remotePath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	if err := c.client.Remove(c.resolve(remotePath)); err != nil {
+		return fmt.Errorf("failed to remove file %s: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+// Remove stats the entry first, also because DELETE doesn't tell a missing
+// entry from an unreachable server.
+func (c *WebdavClient) Remove(ctx context.Context, remotePath string) error {
+	entry, err := c.Stat(ctx, remotePath)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Type == EntryTypeDir {
+		return c.RemoveDir(ctx, remotePath)
+	}
+
+	return c.RemoveFile(ctx, remotePath)
+}
+
+// Rename moves the entry with MOVE, which replaces the target and fails
+// without touching it if the source is missing.
+func (c *WebdavClient) Rename(ctx context.Context, fromPath, toPath string) error {
+	if err := c.init(ctx); err != nil {
+		return err
+	}
+
+	// servers don't agree on the status of a missing parent, so it can't be
+	// created on demand
+	dir, _ := path.Split(toPath)
+	if err := c.MakeDir(ctx, dir); err != nil {
+		return err
+	}
+
+	if err := c.client.Rename(c.resolve(fromPath), c.resolve(toPath), true); err != nil {
+		if gowebdav.IsErrNotFound(err) {
+			err = fmt.Errorf("%w: %s", ErrNotFound, fromPath)
+		}
+		return fmt.Errorf("can't rename %s to %s: %w", fromPath, toPath, markUnreachable(err))
+	}
+
+	return nil
+}
+
+func (c *WebdavClient) Stat(ctx context.Context, remotePath string) (Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return Entry{}, err
+	}
+
+	info, err := c.client.Stat(c.resolve(remotePath))
+	if gowebdav.IsErrNotFound(err) {
+		return Entry{}, fmt.Errorf("%w: %s", ErrNotFound, remotePath)
+	}
+	if err != nil {
+		return Entry{}, fmt.Errorf("can't stat %s: %w", remotePath, markUnreachable(err))
+	}
+
+	// the display name reported by the server is often empty
+	entry := webdavEntry(info)
+	entry.Name = path.Base(remotePath)
+	return entry, nil
+}
+
+func (c *WebdavClient) List(ctx context.Context, remoteDir string) ([]Entry, error) {
+	if err := c.init(ctx); err != nil {
+		return nil, err
+	}
+
+	infos, err := c.client.ReadDir(c.resolve(remoteDir))
+	if gowebdav.IsErrNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't list directory %s: %w", remoteDir, markUnreachable(err))
+	}
+
+	result := make([]Entry, 0, len(infos))
+	for _, info := range infos {
+		result = append(result, webdavEntry(info))
+	}
+
+	return result, nil
+}
+
+// webdavEntry converts the entry, the permissions reported by the library
+// are made up, so they are dropped.
+func webdavEntry(info os.FileInfo) Entry {
+	entryType := EntryTypeFile
+	if info.IsDir() {
+		entryType = EntryTypeDir
+	}
+
+	return Entry{
+		Name:    info.Name(),
+		Type:    entryType,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Mode:    0,
+	}
+}
+
+func (c *WebdavClient) resolve(remotePath string) string {
+	return path.Join("/", remotePath)
+}
@@ -0,0 +1,323 @@
+package debounce
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/watcher"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+// maxWaitFactor limits how long a batch can be postponed by a continuous
+// stream of events, in quiet periods.
+const maxWaitFactor = 10
+
+type pending struct {
+	event watcher.Event
+	// created is true if the path didn't exist before the batch
+	created bool
+}
+
+// Debouncer collects events until the source is quiet for a while and then
+// dispatches them coalesced per path, so a burst of changes results in a
+// single sync of each affected path.
+type Debouncer struct {
+	quiet   time.Duration
+	maxWait time.Duration
+
+	logger logger.Logger
+
+	order   []string
+	pending map[string]pending
+}
+
+func New(quiet time.Duration, logger logger.Logger) *Debouncer {
+	return &Debouncer{
+		quiet:   quiet,
+		maxWait: quiet * maxWaitFactor,
+
+		logger: logger.WithContext("debouncer", ""),
+
+		order:   nil,
+		pending: map[string]pending{},
+	}
+}
+
+// Run consumes events from the input channel and returns the channel of
+// coalesced events. The returned channel is closed when the input channel is
+// closed and all pending events are dispatched, or when ctx is done.
+func (d *Debouncer) Run(ctx context.Context, wg *sync.WaitGroup, in watcher.EventsChannel) watcher.EventsChannel {
+	if d.quiet <= 0 {
+		return in
+	}
+
+	out := make(chan watcher.Event)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(out)
+
+		d.run(ctx, in, out)
+	}()
+
+	return out
+}
+
+func (d *Debouncer) run(ctx context.Context, in watcher.EventsChannel, out chan<- watcher.Event) {
+	timer := time.NewTimer(d.quiet)
+	timer.Stop()
+
+	var ready []watcher.Event
+	var batchStarted time.Time
+
+	for {
+		if in == nil && len(ready) == 0 {
+			return
+		}
+
+		// sending is enabled only when there is something to send
+		var send chan<- watcher.Event
+		var next watcher.Event
+		if len(ready) > 0 {
+			send = out
+			next = ready[0]
+		}
+
+		select {
+		case event, ok := <-in:
+			if !ok {
+				in = nil
+				timer.Stop()
+				ready = append(ready, d.flush()...)
+				continue
+			}
+
+			if len(d.order) == 0 {
+				batchStarted = time.Now()
+			}
+			d.add(event)
+
+			wait := d.quiet
+			if remaining := d.maxWait - time.Since(batchStarted); remaining < wait {
+				wait = max(remaining, 0)
+			}
+			timer.Reset(wait)
+		case <-timer.C:
+			batch := d.flush()
+			d.logger.Debug(ctx, "Batch dispatched", logger.Fields{
+				"events": len(batch),
+			})
+			ready = append(ready, batch...)
+		case send <- next:
+			ready = ready[1:]
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// add merges the event into the pending batch.
+func (d *Debouncer) add(event watcher.Event) {
+	if event.Type == watcher.EventRenamed {
+		d.addRename(event)
+		return
+	}
+
+	key := event.AbsPath
+
+	if d.hasCreatedAncestor(key) {
+		// the whole tree of the created ancestor is going to be synced
+		return
+	}
+
+	if event.Type == watcher.EventRemoved {
+		// removal of a directory covers everything inside it
+		d.dropDescendants(key)
+	}
+
+	prev, exists := d.pending[key]
+	if !exists {
+		d.order = append(d.order, key)
+		d.pending[key] = pending{
+			event:   event,
+			created: event.Type == watcher.EventCreated,
+		}
+		return
+	}
+
+	merged := prev
+	merged.event = event
+	switch event.Type {
+	case watcher.EventRemoved:
+		if prev.created {
+			// created and removed within the batch, nothing to do
+			d.remove(key)
+			return
+		}
+		if prev.event.Type == watcher.EventRenamed {
+			// renamed and removed, the remote still has the old name
+			d.remove(key)
+			d.add(removedEvent(prev.event.OldAbsPath, prev.event.OldRelPath))
+			return
+		}
+	case watcher.EventCreated, watcher.EventModified:
+		if prev.event.Type == watcher.EventRenamed {
+			// the content is synced along with the rename
+			return
+		}
+		if prev.created || prev.event.Type == watcher.EventCreated {
+			merged.event.Type = watcher.EventCreated
+		}
+	case watcher.EventRenamed:
+		// handled by addRename
+	}
+
+	d.pending[key] = merged
+}
+
+// addRename merges the rename into the pending batch. Pending events of the
+// old tree follow the entry to the new name.
+func (d *Debouncer) addRename(event watcher.Event) {
+	from, to := event.OldAbsPath, event.AbsPath
+
+	if p, ok := d.pending[from]; (ok && p.created) || d.hasCreatedAncestor(from) {
+		// the remote has never seen the old name
+		d.takeTree(from)
+		event.Type = watcher.EventCreated
+		event.OldAbsPath, event.OldRelPath = "", ""
+		d.add(event)
+		return
+	}
+
+	if d.hasCreatedAncestor(to) {
+		// the created tree is synced as a whole, only the old name is left
+		d.add(removedEvent(event.OldAbsPath, event.OldRelPath))
+		return
+	}
+
+	moved := d.takeTree(from)
+	for i, e := range moved {
+		if e.AbsPath != from {
+			continue
+		}
+		if e.Type == watcher.EventRenamed {
+			// renamed twice within the batch
+			event.OldAbsPath, event.OldRelPath = e.OldAbsPath, e.OldRelPath
+		}
+		moved = append(moved[:i], moved[i+1:]...)
+		break
+	}
+
+	// the target is replaced, renames into it are removals of the old names
+	for _, replaced := range d.takeTree(to) {
+		if replaced.Type == watcher.EventRenamed {
+			d.add(removedEvent(replaced.OldAbsPath, replaced.OldRelPath))
+		}
+	}
+
+	if event.OldAbsPath == event.AbsPath {
+		// renamed back, but the content might have been changed meanwhile
+		event.Type = watcher.EventModified
+		event.OldAbsPath, event.OldRelPath = "", ""
+	}
+
+	d.order = append(d.order, to)
+	d.pending[to] = pending{
+		event:   event,
+		created: false,
+	}
+
+	for _, e := range moved {
+		e.AbsPath, e.RelPath = rebase(e.AbsPath, e.RelPath, from, event)
+		if e.Type == watcher.EventRenamed {
+			e.OldAbsPath, e.OldRelPath = rebase(e.OldAbsPath, e.OldRelPath, from, event)
+		}
+		d.add(e)
+	}
+}
+
+// rebase moves the path from the old tree of the rename to the new one.
+func rebase(absPath, relPath, from string, rename watcher.Event) (string, string) {
+	suffix, ok := strings.CutPrefix(absPath, from+string(filepath.Separator))
+	if !ok {
+		return absPath, relPath
+	}
+
+	return filepath.Join(rename.AbsPath, suffix), filepath.Join(rename.RelPath, suffix)
+}
+
+func removedEvent(absPath, relPath string) watcher.Event {
+	return watcher.Event{
+		AbsPath:    absPath,
+		RelPath:    relPath,
+		Type:       watcher.EventRemoved,
+		OldAbsPath: "",
+		OldRelPath: "",
+	}
+}
+
+func (d *Debouncer) hasCreatedAncestor(key string) bool {
+	for dir := filepath.Dir(key); dir != key; key, dir = dir, filepath.Dir(dir) {
+		if p, ok := d.pending[dir]; ok && p.event.Type == watcher.EventCreated {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Debouncer) dropDescendants(key string) {
+	prefix := key + string(filepath.Separator)
+	for path := range d.pending {
+		if strings.HasPrefix(path, prefix) {
+			d.remove(path)
+		}
+	}
+}
+
+// takeTree removes pending events of the path and its descendants and
+// returns them in order.
+func (d *Debouncer) takeTree(key string) []watcher.Event {
+	prefix := key + string(filepath.Separator)
+
+	var taken []watcher.Event
+	order := make([]string, 0, len(d.order))
+	for _, path := range d.order {
+		if path == key || strings.HasPrefix(path, prefix) {
+			taken = append(taken, d.pending[path].event)
+			delete(d.pending, path)
+			continue
+		}
+		order = append(order, path)
+	}
+	d.order = order
+
+	return taken
+}
+
+func (d *Debouncer) remove(key string) {
+	delete(d.pending, key)
+	for i, path := range d.order {
+		if path == key {
+			d.order = append(d.order[:i], d.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (d *Debouncer) flush() []watcher.Event {
+	batch := make([]watcher.Event, 0, len(d.order))
+	for _, key := range d.order {
+		batch = append(batch, d.pending[key].event)
+	}
+
+	d.order = nil
+	d.pending = map[string]pending{}
+
+	return batch
+}
@@ -0,0 +1,203 @@
+package debounce_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/debounce"
+	"github.com/capcom6/sftp-sync/internal/watcher"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+func event(rel string, eventType watcher.EventType) watcher.Event {
+	return watcher.Event{
+		AbsPath: filepath.Join(string(filepath.Separator)+"root", rel),
+		RelPath: rel,
+		Type:    eventType,
+
+		OldAbsPath: "",
+		OldRelPath: "",
+	}
+}
+
+func renamed(from, to string) watcher.Event {
+	e := event(to, watcher.EventRenamed)
+	e.OldAbsPath = filepath.Join(string(filepath.Separator)+"root", from)
+	e.OldRelPath = from
+
+	return e
+}
+
+func collect(t *testing.T, events ...watcher.Event) []watcher.Event {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	in := make(chan watcher.Event)
+	wg := sync.WaitGroup{}
+	out := debounce.New(10*time.Millisecond, logger.NewDefault()).Run(ctx, &wg, in)
+
+	go func() {
+		defer close(in)
+		for _, e := range events {
+			in <- e
+		}
+	}()
+
+	var result []watcher.Event
+	for e := range out {
+		result = append(result, e)
+	}
+	wg.Wait()
+
+	return result
+}
+
+func TestDebouncerCoalescing(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		events []watcher.Event
+		want   []watcher.Event
+	}{
+		{
+			name: "create and modify",
+			events: []watcher.Event{
+				event("a.txt", watcher.EventCreated),
+				event("a.txt", watcher.EventModified),
+				event("a.txt", watcher.EventModified),
+			},
+			want: []watcher.Event{event("a.txt", watcher.EventCreated)},
+		},
+		{
+			name: "create and remove",
+			events: []watcher.Event{
+				event("a.txt", watcher.EventCreated),
+				event("a.txt", watcher.EventModified),
+				event("a.txt", watcher.EventRemoved),
+			},
+			want: nil,
+		},
+		{
+			name: "modify and remove",
+			events: []watcher.Event{
+				event("a.txt", watcher.EventModified),
+				event("a.txt", watcher.EventRemoved),
+			},
+			want: []watcher.Event{event("a.txt", watcher.EventRemoved)},
+		},
+		{
+			name: "order of first occurrence",
+			events: []watcher.Event{
+				event("b.txt", watcher.EventModified),
+				event("a.txt", watcher.EventModified),
+				event("b.txt", watcher.EventModified),
+			},
+			want: []watcher.Event{
+				event("b.txt", watcher.EventModified),
+				event("a.txt", watcher.EventModified),
+			},
+		},
+		{
+			name: "directory removal covers children",
+			events: []watcher.Event{
+				event("dir/a.txt", watcher.EventRemoved),
+				event("dir/sub/b.txt", watcher.EventRemoved),
+				event("other.txt", watcher.EventModified),
+				event("dir", watcher.EventRemoved),
+			},
+			want: []watcher.Event{
+				event("other.txt", watcher.EventModified),
+				event("dir", watcher.EventRemoved),
+			},
+		},
+		{
+			name: "directory creation covers children",
+			events: []watcher.Event{
+				event("dir", watcher.EventCreated),
+				event("dir/a.txt", watcher.EventCreated),
+				event("dir/a.txt", watcher.EventModified),
+			},
+			want: []watcher.Event{event("dir", watcher.EventCreated)},
+		},
+		{
+			name: "rename of created file",
+			events: []watcher.Event{
+				event("a.txt", watcher.EventCreated),
+				renamed("a.txt", "b.txt"),
+			},
+			want: []watcher.Event{event("b.txt", watcher.EventCreated)},
+		},
+		{
+			name: "rename chain",
+			events: []watcher.Event{
+				event("a.txt", watcher.EventModified),
+				renamed("a.txt", "b.txt"),
+				renamed("b.txt", "c.txt"),
+			},
+			want: []watcher.Event{renamed("a.txt", "c.txt")},
+		},
+		{
+			name: "rename and remove",
+			events: []watcher.Event{
+				renamed("a.txt", "b.txt"),
+				event("b.txt", watcher.EventRemoved),
+			},
+			want: []watcher.Event{event("a.txt", watcher.EventRemoved)},
+		},
+		{
+			name: "rename back",
+			events: []watcher.Event{
+				renamed("a.txt", "b.txt"),
+				renamed("b.txt", "a.txt"),
+			},
+			want: []watcher.Event{event("a.txt", watcher.EventModified)},
+		},
+		{
+			name: "directory rename moves pending children",
+			events: []watcher.Event{
+				event("dir/a.txt", watcher.EventModified),
+				event("dir/b.txt", watcher.EventRemoved),
+				renamed("dir", "new"),
+			},
+			want: []watcher.Event{
+				renamed("dir", "new"),
+				event("new/a.txt", watcher.EventModified),
+				event("new/b.txt", watcher.EventRemoved),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := collect(t, tt.events...)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("event %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDebouncerDisabled(t *testing.T) {
+	t.Parallel()
+
+	in := make(chan watcher.Event)
+	wg := sync.WaitGroup{}
+	out := debounce.New(0, logger.NewDefault()).Run(context.Background(), &wg, in)
+
+	if out != watcher.EventsChannel(in) {
+		t.Fatal("expected events to be passed through when the quiet period is zero")
+	}
+}
@@ -0,0 +1,303 @@
+package exclude
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const (
+	GitIgnoreFile  = ".gitignore"
+	SyncIgnoreFile = ".syncignore"
+)
+
+// ignoreRule is a line of an ignore file with .gitignore semantics.
+type ignoreRule struct {
+	raw     string
+	pattern string
+	// negate re-includes paths excluded by earlier rules
+	negate bool
+	// dirOnly matches directories only, the pattern has a trailing slash
+	dirOnly bool
+	// anchored patterns contain a slash and match the path relative to the
+	// directory of the file, others match the name at any depth
+	anchored bool
+}
+
+// ignoreFile holds the rules of an ignore file, they apply to the entries of
+// its directory and below.
+type ignoreFile struct {
+	// key is the slash separated path of the file relative to the root
+	key string
+	// base is the slash separated directory of the file, empty for the root
+	base  string
+	rank  int
+	rules []ignoreRule
+}
+
+// LoadIgnoreFiles loads ignore files with the given names from every
+// directory of the source tree. Files of deeper directories take precedence,
+// as well as later names in the same directory.
+func (m *Matcher) LoadIgnoreFiles(names ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ignoreNames = names
+	m.ignoreFiles = nil
+
+	if _, err := m.loadTree(m.sourceRoot); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsIgnoreFile reports whether the path has the name of a loaded ignore file.
+func (m *Matcher) IsIgnoreFile(filePath string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Contains(m.ignoreNames, filepath.Base(filePath))
+}
+
+// Refresh reloads the ignore files affected by a change of the path: the
+// ignore file itself or every ignore file inside a created, removed or
+// renamed directory. It reports whether the rules have changed.
+func (m *Matcher) Refresh(filePath string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.ignoreNames) == 0 {
+		return false, nil
+	}
+
+	rel, ok := m.relative(filePath)
+	if !ok || rel == "." {
+		return false, nil
+	}
+
+	// entries removed or renamed away take their ignore files along
+	changed := false
+	m.ignoreFiles = slices.DeleteFunc(m.ignoreFiles, func(f *ignoreFile) bool {
+		if f.key != rel && !strings.HasPrefix(f.key, rel+"/") {
+			return false
+		}
+		if _, err := os.Stat(m.absolute(f.key)); err == nil {
+			return false
+		}
+
+		changed = true
+		return true
+	})
+
+	absPath := m.absolute(rel)
+	info, err := os.Stat(absPath)
+	switch {
+	case err != nil:
+		return changed, nil
+	case info.IsDir():
+		loaded, loadErr := m.loadTree(absPath)
+		return changed || loaded, loadErr
+	case slices.Contains(m.ignoreNames, path.Base(rel)):
+		return true, m.loadFile(rel)
+	}
+
+	return changed, nil
+}
+
+// loadTree loads ignore files of the directory and its subdirectories which
+// are not excluded.
+func (m *Matcher) loadTree(root string) (bool, error) {
+	loaded := false
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		rel, _ := m.relative(p)
+		if rel != "." {
+			if matched, _ := m.match(rel); matched {
+				return filepath.SkipDir
+			}
+		}
+
+		for _, name := range m.ignoreNames {
+			key := path.Join(rel, name)
+			if _, statErr := os.Stat(m.absolute(key)); statErr != nil {
+				continue
+			}
+			if loadErr := m.loadFile(key); loadErr != nil {
+				return loadErr
+			}
+			loaded = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return loaded, fmt.Errorf("failed to load ignore files: %w", err)
+	}
+
+	return loaded, nil
+}
+
+// loadFile parses the ignore file and replaces its previous rules.
+func (m *Matcher) loadFile(key string) error {
+	data, err := os.ReadFile(m.absolute(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	file := &ignoreFile{
+		key:   key,
+		base:  path.Dir(key),
+		rank:  slices.Index(m.ignoreNames, path.Base(key)),
+		rules: nil,
+	}
+	if file.base == "." {
+		file.base = ""
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		r, ok := parseIgnoreLine(line)
+		if !ok {
+			continue
+		}
+		if !doublestar.ValidatePattern(r.pattern) {
+			return fmt.Errorf("%w: %s:%d: %q", ErrInvalidPattern, key, i+1, r.raw)
+		}
+		file.rules = append(file.rules, r)
+	}
+
+	m.ignoreFiles = slices.DeleteFunc(m.ignoreFiles, func(f *ignoreFile) bool { return f.key == key })
+	m.ignoreFiles = append(m.ignoreFiles, file)
+
+	// shallower files first, so the deeper ones win
+	slices.SortStableFunc(m.ignoreFiles, func(a, b *ignoreFile) int {
+		if da, db := depth(a.base), depth(b.base); da != db {
+			return da - db
+		}
+		return a.rank - b.rank
+	})
+
+	return nil
+}
+
+// matchIgnored applies the ignore files to the slash separated relative
+// path. Once a directory is ignored, nothing inside it can be re-included.
+func (m *Matcher) matchIgnored(rel string, isDir func() bool) (bool, string) {
+	if len(m.ignoreFiles) == 0 {
+		return false, ""
+	}
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i <= len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		dir := i < len(parts) || isDir()
+
+		if ignored, rule := m.ignoreDecision(prefix, dir); ignored {
+			return true, rule
+		}
+	}
+
+	return false, ""
+}
+
+// ignoreDecision returns the result of the last rule matching the path.
+func (m *Matcher) ignoreDecision(rel string, dir bool) (bool, string) {
+	ignored, matchedRule := false, ""
+	for _, f := range m.ignoreFiles {
+		sub := rel
+		if f.base != "" {
+			if !strings.HasPrefix(rel, f.base+"/") {
+				continue
+			}
+			sub = rel[len(f.base)+1:]
+		}
+
+		for _, r := range f.rules {
+			if r.dirOnly && !dir {
+				continue
+			}
+
+			target := sub
+			if !r.anchored {
+				target = path.Base(sub)
+			}
+			if matched, _ := doublestar.Match(r.pattern, target); matched {
+				ignored = !r.negate
+				matchedRule = f.key + ": " + r.raw
+			}
+		}
+	}
+
+	return ignored, matchedRule
+}
+
+// parseIgnoreLine parses a line of an ignore file, comments and blank lines
+// are reported as not ok.
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line[:len(line)-2], " ") + `\ `
+	} else {
+		line = strings.TrimRight(line, " \t")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false //nolint:exhaustruct // not used
+	}
+
+	r := ignoreRule{
+		raw:      line,
+		pattern:  "",
+		negate:   false,
+		dirOnly:  false,
+		anchored: false,
+	}
+
+	switch {
+	case strings.HasPrefix(line, "!"):
+		r.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return ignoreRule{}, false //nolint:exhaustruct // not used
+	}
+	r.pattern = line
+
+	return r, true
+}
+
+func depth(base string) int {
+	if base == "" {
+		return 0
+	}
+
+	return strings.Count(base, "/") + 1
+}
@@ -2,23 +2,41 @@ package exclude
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/bmatcuk/doublestar/v4"
 )
 
+// notIncluded is reported for files skipped because they match none of the
+// include rules.
+const notIncluded = "not included"
+
 type rule struct {
 	value     string
 	isPattern bool
+	// negate re-includes paths excluded by earlier rules
+	negate bool
 }
 
 type Matcher struct {
 	sourceRoot string
-	rules      []rule
+	// rules are applied in order, the last matching one wins
+	rules []rule
+	// hasIncludes excludes files which are not re-included by any rule
+	hasIncludes bool
+
+	// mu guards the ignore files which are reloaded while watching
+	mu          sync.RWMutex
+	ignoreNames []string
+	ignoreFiles []*ignoreFile
 }
 
+// New compiles the exclude rules, a rule prefixed with "!" re-includes paths
+// excluded by earlier rules.
 func New(rules []string, sourceRoot string) (*Matcher, error) {
 	absSourceRoot, err := filepath.Abs(sourceRoot)
 	if err != nil {
@@ -27,20 +45,64 @@ func New(rules []string, sourceRoot string) (*Matcher, error) {
 
 	compiled := make([]rule, 0, len(rules))
 	for _, raw := range rules {
-		normalized := filepath.ToSlash(raw)
-		if !doublestar.ValidatePattern(normalized) {
-			return nil, fmt.Errorf("%w: exclude rule %q is invalid", ErrInvalidPattern, raw)
+		r, compErr := compile(raw, "exclude", false)
+		if compErr != nil {
+			return nil, compErr
 		}
-
-		compiled = append(compiled, rule{
-			value:     normalized,
-			isPattern: hasMeta(normalized),
-		})
+		compiled = append(compiled, r)
 	}
 
 	return &Matcher{
-		sourceRoot: absSourceRoot,
-		rules:      compiled,
+		sourceRoot:  absSourceRoot,
+		rules:       compiled,
+		hasIncludes: false,
+
+		mu:          sync.RWMutex{},
+		ignoreNames: nil,
+		ignoreFiles: nil,
+	}, nil
+}
+
+// Include restricts the files to the ones matching the patterns. Include
+// rules are applied before the exclude rules, so those can still drop
+// included paths.
+func (m *Matcher) Include(patterns ...string) error {
+	compiled := make([]rule, 0, len(patterns)+len(m.rules))
+	for _, raw := range patterns {
+		r, err := compile(raw, "include", true)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, r)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rules = append(compiled, m.rules...)
+	m.hasIncludes = m.hasIncludes || len(patterns) > 0
+
+	return nil
+}
+
+func compile(raw, kind string, negate bool) (rule, error) {
+	normalized := filepath.ToSlash(raw)
+	switch {
+	case strings.HasPrefix(normalized, "!"):
+		negate = !negate
+		normalized = normalized[1:]
+	case strings.HasPrefix(normalized, `\!`):
+		normalized = normalized[1:]
+	}
+
+	if normalized == "" || !doublestar.ValidatePattern(normalized) {
+		return rule{}, fmt.Errorf("%w: %s rule %q is invalid", ErrInvalidPattern, kind, raw) //nolint:exhaustruct // error
+	}
+
+	return rule{
+		value:     normalized,
+		isPattern: hasMeta(normalized),
+		negate:    negate,
 	}, nil
 }
 
@@ -49,45 +111,187 @@ func (m *Matcher) Match(filePath string) bool {
 	return matched
 }
 
+// MatchRule reports whether the path is excluded and the rule which decided
+// about it, if any.
 func (m *Matcher) MatchRule(filePath string) (bool, string) {
-	candidate := filePath
-	if filepath.IsAbs(candidate) {
-		if rel, err := filepath.Rel(m.sourceRoot, candidate); err == nil {
-			candidate = rel
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	normalized := m.normalize(filePath)
+	return m.match(normalized)
+}
+
+// match applies the rules first and the ignore files then.
+func (m *Matcher) match(normalized string) (bool, string) {
+	if normalized == "." || outside(normalized) {
+		return false, ""
+	}
+
+	excluded, decisive := m.matchRules(normalized)
+	if excluded {
+		return true, decisive
+	}
+
+	if ignored, r := m.matchIgnored(normalized, func() bool {
+		// missing entries keep directory-only rules protecting them, e.g.
+		// from deletion
+		exists, isDir := m.stat(normalized)
+		return !exists || isDir
+	}); ignored {
+		return true, r
+	}
+
+	return false, decisive
+}
+
+// matchRules returns the result of the last rule matching the path. A
+// directory isn't excluded while a later rule may re-include its entries.
+func (m *Matcher) matchRules(normalized string) (bool, string) {
+	last := -1
+	for i, r := range m.rules {
+		if r.matches(normalized) {
+			last = i
 		}
 	}
-	normalized := path.Clean(filepath.ToSlash(candidate))
 
-	for _, r := range m.rules {
-		if !r.isPattern {
-			if normalized == r.value || strings.HasPrefix(normalized, r.value+"/") {
-				return true, r.value
-			}
+	var excluded bool
+	var decisive string
+	switch {
+	case last >= 0:
+		excluded = !m.rules[last].negate
+		decisive = m.rules[last].String()
+	case m.hasIncludes:
+		excluded = true
+		decisive = notIncluded
+	default:
+		return false, ""
+	}
+
+	if excluded && m.reincludedBelow(normalized, last) {
+		return false, decisive
+	}
+
+	return excluded, decisive
+}
 
+// reincludedBelow reports whether the path is an existing directory and a
+// negated rule after the given one may match its entries.
+func (m *Matcher) reincludedBelow(normalized string, after int) bool {
+	for _, r := range m.rules[after+1:] {
+		if !r.negate || !r.mayMatchBelow(normalized) {
 			continue
 		}
 
-		// Try direct match first
-		matched, matchErr := doublestar.Match(r.value, normalized)
+		exists, isDir := m.stat(normalized)
+		return exists && isDir
+	}
+
+	return false
+}
+
+func (r rule) String() string {
+	if r.negate {
+		return "!" + r.value
+	}
+
+	return r.value
+}
+
+func (r rule) matches(normalized string) bool {
+	if !r.isPattern {
+		return normalized == r.value || strings.HasPrefix(normalized, r.value+"/")
+	}
+
+	// Try direct match first
+	matched, matchErr := doublestar.Match(r.value, normalized)
+	if matchErr == nil && matched {
+		return true
+	}
+
+	// If direct match fails, try matching against path prefixes
+	// This handles cases like:
+	// - pattern "build/*" matching "build/out/main.bin"
+	// - pattern "**/node_modules" matching "web/node_modules/react/index.js"
+	parts := strings.Split(normalized, "/")
+	for i := 1; i <= len(parts); i++ {
+		prefix := path.Join(parts[:i]...)
+		matched, matchErr = doublestar.Match(r.value, prefix)
 		if matchErr == nil && matched {
-			return true, r.value
+			return true
 		}
+	}
 
-		// If direct match fails, try matching against path prefixes
-		// This handles cases like:
-		// - pattern "build/*" matching "build/out/main.bin"
-		// - pattern "**/node_modules" matching "web/node_modules/react/index.js"
-		parts := strings.Split(normalized, "/")
-		for i := 1; i <= len(parts); i++ {
-			prefix := path.Join(parts[:i]...)
-			matched, matchErr = doublestar.Match(r.value, prefix)
-			if matchErr == nil && matched {
-				return true, r.value
+	return false
+}
+
+// mayMatchBelow reports whether the rule may match an entry inside the
+// directory, judging by the leading segments of the rule.
+func (r rule) mayMatchBelow(dir string) bool {
+	dirParts := strings.Split(dir, "/")
+	for i, part := range strings.Split(r.value, "/") {
+		if part == "**" || i == len(dirParts) {
+			return true
+		}
+
+		if !r.isPattern {
+			if part != dirParts[i] {
+				return false
 			}
+			continue
+		}
+
+		matched, err := doublestar.Match(part, dirParts[i])
+		if err != nil {
+			// e.g. braces spanning segments, can't tell
+			return true
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	// the rule ends at the directory or above it
+	return false
+}
+
+// normalize returns the slash separated path relative to the source root.
+func (m *Matcher) normalize(filePath string) string {
+	candidate := filePath
+	if filepath.IsAbs(candidate) {
+		if rel, err := filepath.Rel(m.sourceRoot, candidate); err == nil {
+			candidate = rel
 		}
 	}
 
-	return false, ""
+	return path.Clean(filepath.ToSlash(candidate))
+}
+
+// relative is like normalize, but reports paths outside the source root.
+func (m *Matcher) relative(filePath string) (string, bool) {
+	rel := m.normalize(filePath)
+	if outside(rel) {
+		return "", false
+	}
+
+	return rel, true
+}
+
+func outside(rel string) bool {
+	return filepath.IsAbs(filepath.FromSlash(rel)) || rel == ".." || strings.HasPrefix(rel, "../")
+}
+
+func (m *Matcher) absolute(rel string) string {
+	return filepath.Join(m.sourceRoot, filepath.FromSlash(rel))
+}
+
+// stat reports whether the entry exists and is a directory.
+func (m *Matcher) stat(rel string) (bool, bool) {
+	info, err := os.Lstat(m.absolute(rel))
+	if err != nil {
+		return false, false
+	}
+
+	return true, info.IsDir()
 }
 
 func hasMeta(pattern string) bool {
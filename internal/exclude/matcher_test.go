@@ -1,6 +1,7 @@
 package exclude_test
 
 import (
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -113,3 +114,153 @@ func TestMatcherAbsolutePathAndRootBoundary(t *testing.T) {
 		t.Fatalf("Match(%q) = %v, want false", outside, got)
 	}
 }
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatcherIgnoreFiles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, ".gitignore"), "# comment\n*.log\n!keep.log\n/dist\nbuild/\nlogs/\n")
+	writeFile(t, filepath.Join(root, ".syncignore"), "secret.txt\n")
+	writeFile(t, filepath.Join(root, "web", ".gitignore"), "!debug.log\ncache\n")
+	writeFile(t, filepath.Join(root, "build", "out.bin"), "")
+	writeFile(t, filepath.Join(root, "src", "build"), "")
+	writeFile(t, filepath.Join(root, "logs", "app.txt"), "")
+
+	matcher, err := exclude.New(nil, root)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err = matcher.LoadIgnoreFiles(exclude.GitIgnoreFile, exclude.SyncIgnoreFile); err != nil {
+		t.Fatalf("LoadIgnoreFiles() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{name: "pattern at any depth", path: "a/b/error.log", want: true},
+		{name: "negation", path: "a/keep.log", want: false},
+		{name: "nested negation", path: "web/debug.log", want: false},
+		{name: "nested file applies below its directory", path: "web/cache/x.js", want: true},
+		{name: "nested file doesn't apply outside", path: "cache/x.js", want: false},
+		{name: "anchored", path: "dist/app.js", want: true},
+		{name: "anchored doesn't match deeper", path: "web/dist/app.js", want: false},
+		{name: "directory only", path: "build/out.bin", want: true},
+		{name: "directory only skips files", path: "src/build", want: false},
+		{name: "can't re-include inside ignored directory", path: "logs/keep.log", want: true},
+		{name: "syncignore", path: filepath.Join(root, "secret.txt"), want: true},
+		{name: "not ignored", path: "src/main.go", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := matcher.Match(tt.path); got != tt.want {
+				t.Fatalf("Match(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatcherRefreshIgnoreFiles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	ignore := filepath.Join(root, "web", exclude.SyncIgnoreFile)
+	writeFile(t, ignore, "*.tmp\n")
+
+	matcher, err := exclude.New(nil, root)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err = matcher.LoadIgnoreFiles(exclude.SyncIgnoreFile); err != nil {
+		t.Fatalf("LoadIgnoreFiles() error = %v", err)
+	}
+
+	if !matcher.Match("web/a.tmp") {
+		t.Fatal("web/a.tmp should be ignored")
+	}
+
+	writeFile(t, ignore, "*.bak\n")
+	if changed, refreshErr := matcher.Refresh(ignore); refreshErr != nil || !changed {
+		t.Fatalf("Refresh() = %v, %v, want true", changed, refreshErr)
+	}
+	if matcher.Match("web/a.tmp") || !matcher.Match("web/a.bak") {
+		t.Fatal("modified rules should be applied")
+	}
+
+	if err = os.RemoveAll(filepath.Join(root, "web")); err != nil {
+		t.Fatal(err)
+	}
+	if changed, refreshErr := matcher.Refresh(filepath.Join(root, "web")); refreshErr != nil || !changed {
+		t.Fatalf("Refresh() = %v, %v, want true", changed, refreshErr)
+	}
+	if matcher.Match("web/a.bak") {
+		t.Fatal("rules of the removed directory should be dropped")
+	}
+
+	writeFile(t, filepath.Join(root, "lib", exclude.SyncIgnoreFile), "vendor/\n")
+	if changed, refreshErr := matcher.Refresh(filepath.Join(root, "lib")); refreshErr != nil || !changed {
+		t.Fatalf("Refresh() = %v, %v, want true", changed, refreshErr)
+	}
+	if !matcher.Match("lib/vendor/x.go") {
+		t.Fatal("rules of the created directory should be loaded")
+	}
+}
+
+func TestMatcherIncludeAndNegation(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "src", "app", "index.php"), "")
+	writeFile(t, filepath.Join(root, "lib", "util.php"), "")
+	writeFile(t, filepath.Join(root, "vendor", "autoload.php"), "")
+	writeFile(t, filepath.Join(root, "vendor", "pkg", "lib.php"), "")
+
+	matcher, err := exclude.New([]string{"vendor/**", "!vendor/autoload.php", "**/*.tpl.php"}, root)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err = matcher.Include("src/**/*.php", "src/**/*.css", "vendor/**"); err != nil {
+		t.Fatalf("Include() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+		rule string
+	}{
+		{name: "included", path: "src/app/index.php", want: false, rule: "!src/**/*.php"},
+		{name: "directory with included entries", path: "src/app", want: false, rule: "not included"},
+		{name: "not included", path: "src/app/readme.md", want: true, rule: "not included"},
+		{name: "directory without included entries", path: "lib", want: true, rule: "not included"},
+		{name: "excluded after include", path: "src/app/form.tpl.php", want: true, rule: "**/*.tpl.php"},
+		{name: "negated exclude", path: "vendor/autoload.php", want: false, rule: "!vendor/autoload.php"},
+		{name: "excluded directory keeps negated entries", path: "vendor", want: false, rule: "vendor/**"},
+		{name: "excluded directory", path: "vendor/pkg", want: true, rule: "vendor/**"},
+		{name: "excluded file", path: "vendor/pkg/lib.php", want: true, rule: "vendor/**"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, rule := matcher.MatchRule(tt.path)
+			if got != tt.want || rule != tt.rule {
+				t.Fatalf("MatchRule(%q) = %v, %q, want %v, %q", tt.path, got, rule, tt.want, tt.rule)
+			}
+		})
+	}
+}
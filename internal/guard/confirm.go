@@ -0,0 +1,144 @@
+package guard
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// pollInterval is how often the control directory is checked for decisions.
+const pollInterval = time.Second
+
+// Confirmer asks for a decision about paused deletions on the terminal, if
+// any, and via the control directory at the same time.
+type Confirmer struct {
+	control *Control
+	seq     atomic.Int64
+
+	out io.Writer
+	// lines are read from the terminal by a single goroutine, nil without
+	// a terminal
+	lines chan string
+	// turn lets a single question be asked at a time
+	turn chan struct{}
+}
+
+// NewConfirmer prompts on in and out when in is a terminal.
+func NewConfirmer(control *Control, in *os.File, out io.Writer) *Confirmer {
+	c := &Confirmer{
+		control: control,
+		seq:     atomic.Int64{},
+
+		out:   out,
+		lines: nil,
+		turn:  make(chan struct{}, 1),
+	}
+
+	if IsTerminal(in) {
+		c.lines = make(chan string)
+		go func() {
+			// the goroutine lives as long as the process, a read can't be
+			// interrupted anyway
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				c.lines <- scanner.Text()
+			}
+			close(c.lines)
+		}()
+	}
+
+	return c
+}
+
+// IsTerminal reports whether the file is an interactive terminal.
+func IsTerminal(f *os.File) bool {
+	return f != nil && term.IsTerminal(int(f.Fd()))
+}
+
+// NewID returns a unique ID for a request of this process.
+func (c *Confirmer) NewID() string {
+	return fmt.Sprintf("%d-%d", os.Getpid(), c.seq.Add(1))
+}
+
+// Await publishes the request and waits until it's approved or discarded.
+// The request is withdrawn when the decision is made or ctx is done.
+func (c *Confirmer) Await(ctx context.Context, req Request) (Decision, error) {
+	if err := c.control.Publish(req); err != nil {
+		return "", err
+	}
+	defer func() { _ = c.control.Withdraw(req.ID) }()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	answers := make(chan Decision, 1)
+	if c.lines != nil {
+		go func() {
+			if decision, ok := c.ask(ctx, req); ok {
+				answers <- decision
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case decision := <-answers:
+			return decision, nil
+		case <-ticker.C:
+			decision, ok, err := c.control.Decision(req.ID)
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				return decision, nil
+			}
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+// ask prompts on the terminal until the answer is yes or no.
+func (c *Confirmer) ask(ctx context.Context, req Request) (Decision, bool) {
+	select {
+	case c.turn <- struct{}{}:
+		defer func() { <-c.turn }()
+	case <-ctx.Done():
+		return "", false
+	}
+
+	for {
+		_, _ = fmt.Fprintf(
+			c.out,
+			"\n%d entries of %s were removed at once, delete them on the remote too? [yes/no]: ",
+			req.Removals,
+			req.Source,
+		)
+
+		select {
+		case line, ok := <-c.lines:
+			if !ok {
+				return "", false
+			}
+
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				return DecisionApprove, true
+			case "n", "no":
+				return DecisionDiscard, true
+			}
+		case <-ctx.Done():
+			return "", false
+		}
+	}
+}
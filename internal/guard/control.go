@@ -0,0 +1,187 @@
+package guard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	DecisionApprove Decision = "approve"
+	DecisionDiscard Decision = "discard"
+
+	requestExt  = ".json"
+	decisionExt = ".decision"
+)
+
+// Decision resolves paused deletions.
+type Decision string
+
+// Request describes deletions paused until they are confirmed.
+type Request struct {
+	ID       string    `json:"id"`
+	PID      int       `json:"pid"`
+	Source   string    `json:"source"`
+	Removals int       `json:"removals"`
+	PausedAt time.Time `json:"paused_at"`
+	// Paths are the first removed paths, as a hint of what's going on.
+	Paths []string `json:"paths"`
+}
+
+// Control exchanges requests and decisions with other processes via files,
+// so paused deletions can be confirmed by a command.
+type Control struct {
+	dir string
+}
+
+// DefaultDir returns the directory of the requests in the user cache
+// directory.
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "sftp-sync", "deletions"), nil
+}
+
+func NewControl(dir string) *Control {
+	return &Control{
+		dir: dir,
+	}
+}
+
+// Publish makes the request visible to List, it replaces the previous
+// version of the request.
+func (c *Control) Publish(req Request) error {
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	return c.write(req.ID+requestExt, data)
+}
+
+// Withdraw removes the request and its decision.
+func (c *Control) Withdraw(id string) error {
+	for _, name := range []string{id + requestExt, id + decisionExt} {
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("os.Remove: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// List returns the pending requests, the oldest first.
+func (c *Control) List() ([]Request, error) {
+	entries, err := os.ReadDir(c.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	requests := make([]Request, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), requestExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		req, getErr := c.Get(id)
+		if errors.Is(getErr, ErrRequestNotFound) {
+			// withdrawn meanwhile
+			continue
+		}
+		if getErr != nil {
+			return nil, getErr
+		}
+		requests = append(requests, req)
+	}
+
+	slices.SortFunc(requests, func(a, b Request) int {
+		return a.PausedAt.Compare(b.PausedAt)
+	})
+
+	return requests, nil
+}
+
+// Get returns the request or ErrRequestNotFound.
+func (c *Control) Get(id string) (Request, error) {
+	var req Request
+
+	data, err := os.ReadFile(filepath.Join(c.dir, filepath.Base(id)+requestExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return req, fmt.Errorf("%w: %s", ErrRequestNotFound, id)
+	}
+	if err != nil {
+		return req, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	if jsonErr := json.Unmarshal(data, &req); jsonErr != nil {
+		return req, fmt.Errorf("json.Unmarshal: %s: %w", id, jsonErr)
+	}
+
+	return req, nil
+}
+
+// Resolve records the decision for the pending request.
+func (c *Control) Resolve(id string, decision Decision) error {
+	if _, err := c.Get(id); err != nil {
+		return err
+	}
+
+	return c.write(filepath.Base(id)+decisionExt, []byte(decision))
+}
+
+// Decision returns the decision recorded for the request, if any.
+func (c *Control) Decision(id string) (Decision, bool, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, id+decisionExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	switch decision := Decision(strings.TrimSpace(string(data))); decision {
+	case DecisionApprove, DecisionDiscard:
+		return decision, true, nil
+	}
+
+	return "", false, nil
+}
+
+// write replaces the file atomically, so readers never see a partial one.
+func (c *Control) write(name string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("os.MkdirAll: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, wErr := tmp.Write(data); wErr != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("tmp.Write: %w", wErr)
+	}
+	if clErr := tmp.Close(); clErr != nil {
+		return fmt.Errorf("tmp.Close: %w", clErr)
+	}
+
+	if rnErr := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); rnErr != nil {
+		return fmt.Errorf("os.Rename: %w", rnErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,9 @@
+package guard
+
+import "errors"
+
+var (
+	ErrInvalidThreshold = errors.New("invalid threshold")
+	ErrRequestNotFound  = errors.New("request not found")
+	ErrAmbiguousRequest = errors.New("several requests are pending, choose one by ID")
+)
@@ -0,0 +1,147 @@
+package guard
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Threshold is the number of removals within the window which pauses
+// further deletions. Either Count or Percent is set, zero disables the guard.
+type Threshold struct {
+	// Count is the absolute number of removals.
+	Count int
+	// Percent is the share of the entries of the tree, in percent.
+	Percent float64
+}
+
+// ParseThreshold parses a number of removals, e.g. "100", or a percentage of
+// the tree, e.g. "25%". An empty value or zero disables the guard.
+func ParseThreshold(value string) (Threshold, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Threshold{Count: 0, Percent: 0}, nil
+	}
+
+	if number, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return Threshold{}, fmt.Errorf("%w: %q", ErrInvalidThreshold, value) //nolint:exhaustruct // error
+		}
+		return Threshold{Count: 0, Percent: percent}, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return Threshold{}, fmt.Errorf("%w: %q", ErrInvalidThreshold, value) //nolint:exhaustruct // error
+	}
+
+	return Threshold{Count: count, Percent: 0}, nil
+}
+
+// Enabled reports whether the threshold is set.
+func (t Threshold) Enabled() bool {
+	return t.Count > 0 || t.Percent > 0
+}
+
+func (t Threshold) String() string {
+	if t.Percent > 0 {
+		return strconv.FormatFloat(t.Percent, 'f', -1, 64) + "%"
+	}
+
+	return strconv.Itoa(t.Count)
+}
+
+// Guard counts removals within a sliding window and trips when they exceed
+// the threshold.
+type Guard struct {
+	threshold Threshold
+	window    time.Duration
+
+	mu sync.Mutex
+	// total is the number of entries of the tree the percentage refers to
+	total   int
+	records []record
+}
+
+// record is a removal covering the number of entries, e.g. a whole
+// directory.
+type record struct {
+	at      time.Time
+	entries int
+}
+
+func New(threshold Threshold, window time.Duration) *Guard {
+	return &Guard{
+		threshold: threshold,
+		window:    window,
+
+		mu:      sync.Mutex{},
+		total:   0,
+		records: nil,
+	}
+}
+
+// SetTotal sets the number of entries of the tree.
+func (g *Guard) SetTotal(total int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.total = total
+}
+
+// Record counts the removal of the given number of entries and reports
+// whether the removals within the window exceed the threshold. A removal
+// which trips the guard isn't counted, so the same one trips it again until
+// Reset.
+func (g *Guard) Record(now time.Time, entries int) bool {
+	if !g.threshold.Enabled() {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cutoff := now.Add(-g.window)
+	removals := max(entries, 1)
+	kept := g.records[:0]
+	for _, r := range g.records {
+		if r.at.After(cutoff) {
+			kept = append(kept, r)
+			removals += r.entries
+		}
+	}
+	g.records = kept
+
+	if g.exceeds(removals) {
+		return true
+	}
+
+	g.records = append(g.records, record{at: now, entries: max(entries, 1)})
+	return false
+}
+
+// Reset forgets the removals recorded so far.
+func (g *Guard) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.records = nil
+}
+
+func (g *Guard) exceeds(removals int) bool {
+	if g.threshold.Count > 0 && removals > g.threshold.Count {
+		return true
+	}
+
+	// removals of entries missing locally, e.g. with an empty source, are
+	// more than the whole tree
+	if g.threshold.Percent > 0 {
+		total := max(g.total, removals)
+		return float64(removals)*100/float64(total) > g.threshold.Percent
+	}
+
+	return false
+}
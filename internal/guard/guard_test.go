@@ -0,0 +1,129 @@
+package guard_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/guard"
+)
+
+func TestParseThreshold(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value string
+		want  guard.Threshold
+		err   bool
+	}{
+		{value: "", want: guard.Threshold{Count: 0, Percent: 0}, err: false},
+		{value: "100", want: guard.Threshold{Count: 100, Percent: 0}, err: false},
+		{value: "25%", want: guard.Threshold{Count: 0, Percent: 25}, err: false},
+		{value: "2.5 %", want: guard.Threshold{Count: 0, Percent: 2.5}, err: false},
+		{value: "-1", want: guard.Threshold{Count: 0, Percent: 0}, err: true},
+		{value: "150%", want: guard.Threshold{Count: 0, Percent: 0}, err: true},
+		{value: "many", want: guard.Threshold{Count: 0, Percent: 0}, err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := guard.ParseThreshold(tt.value)
+		if tt.err {
+			if !errors.Is(err, guard.ErrInvalidThreshold) {
+				t.Errorf("ParseThreshold(%q) error = %v, want ErrInvalidThreshold", tt.value, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseThreshold(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestGuardRecord(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	g := guard.New(guard.Threshold{Count: 2, Percent: 0}, time.Minute)
+	if g.Record(now, 1) || g.Record(now, 1) {
+		t.Fatal("tripped within the threshold")
+	}
+	if !g.Record(now, 1) {
+		t.Fatal("not tripped above the threshold")
+	}
+	if g.Record(now.Add(2*time.Minute), 1) {
+		t.Fatal("removals outside the window are counted")
+	}
+
+	g.Reset()
+	if g.Record(now, 1) || g.Record(now, 1) {
+		t.Fatal("tripped after reset")
+	}
+
+	percent := guard.New(guard.Threshold{Count: 0, Percent: 20}, time.Minute)
+	percent.SetTotal(10)
+	if percent.Record(now, 1) || percent.Record(now, 1) {
+		t.Fatal("tripped within the percentage")
+	}
+	if !percent.Record(now, 1) {
+		t.Fatal("not tripped above the percentage")
+	}
+
+	// a removed directory counts with everything inside
+	weighted := guard.New(guard.Threshold{Count: 100, Percent: 0}, time.Minute)
+	if !weighted.Record(now, 10000) {
+		t.Fatal("not tripped by a single large removal")
+	}
+
+	// entries missing locally make up the whole tree
+	empty := guard.New(guard.Threshold{Count: 0, Percent: 50}, time.Minute)
+	if !empty.Record(now, 1) {
+		t.Fatal("not tripped with an empty tree")
+	}
+
+	disabled := guard.New(guard.Threshold{Count: 0, Percent: 0}, time.Minute)
+	for range 100 {
+		if disabled.Record(now, 1) {
+			t.Fatal("disabled guard tripped")
+		}
+	}
+}
+
+func TestControlResolve(t *testing.T) {
+	t.Parallel()
+
+	control := guard.NewControl(t.TempDir())
+	req := guard.Request{
+		ID:       "1-1",
+		PID:      1,
+		Source:   "/src",
+		Removals: 3,
+		PausedAt: time.Now(),
+		Paths:    []string{"a", "b", "c"},
+	}
+	if err := control.Publish(req); err != nil {
+		t.Fatal(err)
+	}
+
+	requests, err := control.List()
+	if err != nil || len(requests) != 1 || requests[0].Removals != 3 {
+		t.Fatalf("List() = %+v, %v", requests, err)
+	}
+
+	if _, ok, _ := control.Decision(req.ID); ok {
+		t.Fatal("decision before resolve")
+	}
+	if resErr := control.Resolve(req.ID, guard.DecisionApprove); resErr != nil {
+		t.Fatal(resErr)
+	}
+	if decision, ok, _ := control.Decision(req.ID); !ok || decision != guard.DecisionApprove {
+		t.Fatalf("Decision() = %q, %v", decision, ok)
+	}
+
+	if wErr := control.Withdraw(req.ID); wErr != nil {
+		t.Fatal(wErr)
+	}
+	if resErr := control.Resolve(req.ID, guard.DecisionDiscard); !errors.Is(resErr, guard.ErrRequestNotFound) {
+		t.Fatalf("Resolve() after withdraw = %v", resErr)
+	}
+}
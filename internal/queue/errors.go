@@ -0,0 +1,7 @@
+package queue
+
+import "errors"
+
+var (
+	ErrUnknownQueue = errors.New("unknown queue")
+)
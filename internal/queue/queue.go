@@ -0,0 +1,348 @@
+package queue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// BaseDelay is the delay before the first retry, it's doubled by every
+	// failed attempt up to MaxDelay.
+	BaseDelay = 5 * time.Second
+	MaxDelay  = 10 * time.Minute
+
+	fileExt = ".json"
+	// idLength is the number of hex digits of the ID of a queue.
+	idLength = 12
+)
+
+// Item is a path which failed to sync and waits for a retry. The current
+// state of the path is synced on retry, so items of the same path coalesce.
+type Item struct {
+	Path    string `json:"path"`
+	AbsPath string `json:"abs_path"`
+
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	FailedAt    time.Time `json:"failed_at"`
+	NextAttempt time.Time `json:"next_attempt"`
+}
+
+// file is the persisted form of the queue.
+type file struct {
+	Source string `json:"source"`
+	Dest   string `json:"dest"`
+	Items  []Item `json:"items"`
+}
+
+// Queue keeps the failed paths of a source and destination pair and persists
+// them on every change, so they are retried after a restart.
+type Queue struct {
+	path string
+
+	mu    sync.Mutex
+	data  file
+	index map[string]int
+}
+
+// DefaultDir returns the directory of the queues in the user cache directory.
+func DefaultDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "sftp-sync", "queue"), nil
+}
+
+// ID identifies the queue of the source and destination pair. The
+// destination may contain credentials, so only its hash is used.
+func ID(source, dest string) string {
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+
+	sum := sha256.Sum256([]byte(source + "\n" + dest))
+	return hex.EncodeToString(sum[:])[:idLength]
+}
+
+// Open loads the queue of the source and destination pair from the
+// directory, a missing queue is empty. Loaded items are due at once.
+// displayDest is stored for listing.
+func Open(dir, source, dest, displayDest string) (*Queue, error) {
+	q := &Queue{
+		path: filepath.Join(dir, ID(source, dest)+fileExt),
+
+		mu: sync.Mutex{},
+		data: file{
+			Source: source,
+			Dest:   displayDest,
+			Items:  nil,
+		},
+		index: map[string]int{},
+	}
+
+	loaded, err := read(q.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	// the work left by the previous run is replayed at once
+	for i := range loaded.Items {
+		loaded.Items[i].NextAttempt = time.Time{}
+	}
+	q.data.Items = loaded.Items
+	q.reindex()
+
+	return q, nil
+}
+
+// Add records the failure of the path and schedules the next attempt.
+func (q *Queue) Add(item Item, err error, now time.Time) (Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if i, ok := q.index[item.Path]; ok {
+		item.Attempts = q.data.Items[i].Attempts
+		q.data.Items[i] = item
+	} else {
+		q.data.Items = append(q.data.Items, item)
+		q.reindex()
+	}
+
+	i := q.index[item.Path]
+	q.data.Items[i].Attempts++
+	q.data.Items[i].LastError = err.Error()
+	q.data.Items[i].FailedAt = now
+	q.data.Items[i].NextAttempt = now.Add(Backoff(q.data.Items[i].Attempts))
+
+	return q.data.Items[i], q.save()
+}
+
+// Done removes the paths after they have been synced.
+func (q *Queue) Done(paths ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	changed := false
+	for _, p := range paths {
+		if _, ok := q.index[p]; ok {
+			q.data.Items = slices.DeleteFunc(q.data.Items, func(item Item) bool { return item.Path == p })
+			q.reindex()
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return q.save()
+}
+
+// Due returns the items whose next attempt is not after now and postpones
+// them, so they are not returned again until they fail or are done.
+func (q *Queue) Due(now time.Time) []Item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var due []Item
+	for i := range q.data.Items {
+		if q.data.Items[i].NextAttempt.After(now) {
+			continue
+		}
+
+		due = append(due, q.data.Items[i])
+		q.data.Items[i].NextAttempt = now.Add(MaxDelay)
+	}
+
+	return due
+}
+
+// Next returns the time of the earliest attempt, false if the queue is empty.
+func (q *Queue) Next() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.data.Items) == 0 {
+		return time.Time{}, false
+	}
+
+	next := q.data.Items[0].NextAttempt
+	for _, item := range q.data.Items[1:] {
+		if item.NextAttempt.Before(next) {
+			next = item.NextAttempt
+		}
+	}
+
+	return next, true
+}
+
+// Paths returns the queued paths in order.
+func (q *Queue) Paths() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	paths := make([]string, 0, len(q.data.Items))
+	for _, item := range q.data.Items {
+		paths = append(paths, item.Path)
+	}
+
+	return paths
+}
+
+func (q *Queue) reindex() {
+	clear(q.index)
+	for i, item := range q.data.Items {
+		q.index[item.Path] = i
+	}
+}
+
+// save writes the queue atomically, an empty queue is removed.
+func (q *Queue) save() error {
+	if len(q.data.Items) == 0 {
+		if err := os.Remove(q.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("os.Remove: %w", err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(q.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %w", err)
+	}
+
+	dir := filepath.Dir(q.path)
+	if mkErr := os.MkdirAll(dir, 0o700); mkErr != nil {
+		return fmt.Errorf("os.MkdirAll: %w", mkErr)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(q.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("os.CreateTemp: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, wErr := tmp.Write(data); wErr != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("tmp.Write: %w", wErr)
+	}
+	if clErr := tmp.Close(); clErr != nil {
+		return fmt.Errorf("tmp.Close: %w", clErr)
+	}
+
+	if rnErr := os.Rename(tmp.Name(), q.path); rnErr != nil {
+		return fmt.Errorf("os.Rename: %w", rnErr)
+	}
+
+	return nil
+}
+
+// Backoff returns the delay before the attempt following the given number of
+// failed ones: exponential with a random jitter of up to a half, so retries
+// of many paths don't hit the server at once.
+func Backoff(attempts int) time.Duration {
+	delay := MaxDelay
+	if attempts < 32 {
+		delay = min(BaseDelay<<max(attempts-1, 0), MaxDelay)
+	}
+
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int64N(half+1)) //nolint:gosec // jitter doesn't need a secure source
+}
+
+// Summary describes a persisted queue.
+type Summary struct {
+	ID     string
+	Source string
+	Dest   string
+	Items  []Item
+}
+
+// List returns the persisted queues of the directory.
+func List(dir string) ([]Summary, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("os.ReadDir: %w", err)
+	}
+
+	var result []Summary
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), fileExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		data, readErr := read(filepath.Join(dir, entry.Name()))
+		if errors.Is(readErr, os.ErrNotExist) {
+			continue
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		result = append(result, Summary{
+			ID:     id,
+			Source: data.Source,
+			Dest:   data.Dest,
+			Items:  data.Items,
+		})
+	}
+
+	return result, nil
+}
+
+// Clear removes the queues with the IDs, or all queues if none are given.
+// Running sync processes keep their items in memory and persist them again
+// on the next change.
+func Clear(dir string, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		summaries, err := List(dir)
+		if err != nil {
+			return 0, err
+		}
+		for _, s := range summaries {
+			ids = append(ids, s.ID)
+		}
+	}
+
+	cleared := 0
+	for _, id := range ids {
+		err := os.Remove(filepath.Join(dir, filepath.Base(id)+fileExt))
+		if errors.Is(err, os.ErrNotExist) {
+			return cleared, fmt.Errorf("%w: %s", ErrUnknownQueue, id)
+		}
+		if err != nil {
+			return cleared, fmt.Errorf("os.Remove: %w", err)
+		}
+		cleared++
+	}
+
+	return cleared, nil
+}
+
+func read(path string) (file, error) {
+	var data file
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return data, fmt.Errorf("os.ReadFile: %w", err)
+	}
+
+	if jsonErr := json.Unmarshal(raw, &data); jsonErr != nil {
+		return data, fmt.Errorf("json.Unmarshal: %s: %w", path, jsonErr)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,168 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+const (
+	// CompareNone always uploads files.
+	CompareNone CompareStrategy = "none"
+	// CompareSizeMtime treats a remote file of the same size which is not
+	// older than the local one as unchanged.
+	CompareSizeMtime CompareStrategy = "size-mtime"
+	// CompareHash compares checksums when the backend provides them and
+	// falls back to CompareSizeMtime otherwise.
+	CompareHash CompareStrategy = "hash"
+)
+
+type CompareStrategy string
+
+func ParseCompareStrategy(value string) (CompareStrategy, error) {
+	switch strategy := CompareStrategy(value); strategy {
+	case CompareNone, CompareSizeMtime, CompareHash:
+		return strategy, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", ErrUnknownCompareStrategy, value)
+}
+
+// isUnchanged reports whether the remote entry matches the local file and
+// the reason of the decision. Changed is set for files reported as changed by
+// the watcher, they are never skipped only because the remote isn't older.
+func (s *Syncer) isUnchanged(
+	ctx context.Context,
+	absPath, relPath string,
+	local os.FileInfo,
+	remote client.Entry,
+	changed bool,
+) (bool, string) {
+	if s.options.Compare == CompareNone {
+		return false, "comparison disabled"
+	}
+
+	if remote.Type != client.EntryTypeFile {
+		return false, "not a file"
+	}
+
+	if remote.Size != local.Size() {
+		return false, "size differs"
+	}
+
+	if s.options.Compare == CompareHash {
+		if same, reason, ok := s.compareHash(ctx, absPath, relPath); ok {
+			return same, reason
+		}
+	}
+
+	// timestamps are compared with a second precision as most servers don't
+	// report fractions
+	localTime := local.ModTime().Truncate(time.Second)
+	if s.preservesModTime(ctx) {
+		if !localTime.Equal(remote.ModTime.Truncate(time.Second)) {
+			return false, "modification time differs"
+		}
+		return true, "same size and modification time"
+	}
+
+	// the remote time is the time of the upload, which is no proof for a
+	// same-size edit reported by the watcher
+	if changed {
+		return false, "changed locally"
+	}
+	if localTime.After(remote.ModTime) {
+		return false, "local file is newer"
+	}
+
+	return true, "same size and not older"
+}
+
+// preservesModTime reports whether remote files keep the local modification
+// time, so equal times mean the same version. It's asked once per syncer
+// unless the backend fails to answer.
+func (s *Syncer) preservesModTime(ctx context.Context) bool {
+	s.preserveMu.Lock()
+	defer s.preserveMu.Unlock()
+
+	if s.preserves != nil {
+		return *s.preserves
+	}
+
+	preserver, ok := s.client.(client.TimePreserver)
+	if !ok {
+		s.preserves = new(bool)
+		return false
+	}
+
+	preserves, err := preserver.PreservesModTime(ctx)
+	if err != nil {
+		s.logger.Debug(ctx, "Failed to check whether modification times are preserved", logger.Fields{
+			"error": err,
+		})
+		return false
+	}
+	s.preserves = &preserves
+
+	return preserves
+}
+
+// compareHash compares checksums, the last result is false if the backend
+// can't provide them.
+func (s *Syncer) compareHash(ctx context.Context, absPath, relPath string) (bool, string, bool) {
+	hasher, ok := s.client.(client.Hasher)
+	if !ok {
+		return false, "", false
+	}
+
+	remote, err := hasher.Hash(ctx, pathNormalize(relPath))
+	if err != nil {
+		if !errors.Is(err, client.ErrHashNotSupported) {
+			s.logger.Warn(ctx, "Failed to get remote checksum", logger.Fields{
+				fieldPath: relPath,
+				"error":   err,
+			})
+		}
+		return false, "", false
+	}
+
+	local, err := localChecksum(absPath, remote.Algorithm)
+	if err != nil {
+		s.logger.Warn(ctx, "Failed to get local checksum", logger.Fields{
+			fieldPath: relPath,
+			"error":   err,
+		})
+		return false, "", false
+	}
+
+	if local != remote.Value {
+		return false, "checksum differs", true
+	}
+
+	return true, "same " + string(remote.Algorithm) + " checksum", true
+}
+
+func localChecksum(absPath string, algorithm client.HashAlgorithm) (string, error) {
+	h, err := client.NewHash(algorithm)
+	if err != nil {
+		return "", fmt.Errorf("client.NewHash: %w", err)
+	}
+
+	f, err := os.Open(absPath)
+	if err != nil {
+		return "", fmt.Errorf("os.Open: %w", err)
+	}
+	defer f.Close()
+
+	if _, cpErr := io.Copy(h, f); cpErr != nil {
+		return "", fmt.Errorf("io.Copy: %w", cpErr)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
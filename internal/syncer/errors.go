@@ -0,0 +1,10 @@
+package syncer
+
+import "errors"
+
+var (
+	ErrUnknownCompareStrategy = errors.New("unknown compare strategy")
+	ErrTrashDisabled          = errors.New("trash directory is not set")
+	ErrNotInTrash             = errors.New("not found in trash")
+	ErrInvalidRestorePath     = errors.New("invalid path to restore")
+)
@@ -0,0 +1,205 @@
+package syncer
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+// poolQueueFactor limits the number of queued tasks per worker, so producers
+// are blocked instead of piling up an unbounded backlog.
+const poolQueueFactor = 16
+
+// Task is run by a worker of the pool with the worker's own syncer.
+type Task func(ctx context.Context, s *Syncer)
+
+// Pool runs tasks concurrently, each worker owns a syncer with a separate
+// connection to the remote.
+//
+// Tasks are keyed by absolute local paths. A task is never started while
+// an earlier task for the same path, its ancestor or its descendant is queued
+// or running, so e.g. a removal can't overtake an upload of the same file.
+type Pool struct {
+	syncers []*Syncer
+
+	logger logger.Logger
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []*poolTask
+	capacity int
+	stopped  bool
+}
+
+type poolTask struct {
+	paths   []string
+	run     Task
+	running bool
+}
+
+func NewPool(syncers []*Syncer, logger logger.Logger) *Pool {
+	p := &Pool{
+		syncers: syncers,
+
+		logger: logger.WithContext("pool", ""),
+
+		mu:       sync.Mutex{},
+		cond:     nil,
+		queue:    nil,
+		capacity: max(len(syncers), 1) * poolQueueFactor,
+		stopped:  false,
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p
+}
+
+// Size returns the number of workers.
+func (p *Pool) Size() int {
+	return len(p.syncers)
+}
+
+// Start runs the workers until ctx is done. Queued tasks are dropped then.
+func (p *Pool) Start(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		<-ctx.Done()
+
+		p.mu.Lock()
+		p.stopped = true
+		p.queue = nil
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}()
+
+	for _, s := range p.syncers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			p.work(ctx, s)
+		}()
+	}
+
+	p.logger.Debug(ctx, "Workers started", logger.Fields{"workers": len(p.syncers)})
+}
+
+// Submit queues the task touching the paths. It blocks while the queue is
+// full and returns false if the pool is stopped.
+func (p *Pool) Submit(task Task, paths ...string) bool {
+	for i, path := range paths {
+		paths[i] = filepath.Clean(path)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !p.stopped && len(p.queue) >= p.capacity {
+		p.cond.Wait()
+	}
+	if p.stopped {
+		return false
+	}
+
+	p.queue = append(p.queue, &poolTask{
+		paths:   paths,
+		run:     task,
+		running: false,
+	})
+	p.cond.Broadcast()
+
+	return true
+}
+
+// Wait blocks until all submitted tasks are completed or the pool is stopped.
+func (p *Pool) Wait() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for !p.stopped && len(p.queue) > 0 {
+		p.cond.Wait()
+	}
+}
+
+func (p *Pool) work(ctx context.Context, s *Syncer) {
+	for {
+		p.mu.Lock()
+		t := p.next()
+		for t == nil && !p.stopped {
+			p.cond.Wait()
+			t = p.next()
+		}
+		if p.stopped {
+			p.mu.Unlock()
+			return
+		}
+		t.running = true
+		p.mu.Unlock()
+
+		t.run(ctx, s)
+
+		p.mu.Lock()
+		p.done(t)
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	}
+}
+
+// next returns the first task which doesn't conflict with earlier ones.
+func (p *Pool) next() *poolTask {
+	for i, t := range p.queue {
+		if t.running {
+			continue
+		}
+
+		blocked := false
+		for _, prev := range p.queue[:i] {
+			if pathsOverlap(prev.paths, t.paths) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func (p *Pool) done(t *poolTask) {
+	for i, queued := range p.queue {
+		if queued == t {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// pathsOverlap reports whether any paths are equal or one contains the other.
+func pathsOverlap(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if pathOverlaps(x, y) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func pathOverlaps(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	sep := string(filepath.Separator)
+	return strings.HasPrefix(a, strings.TrimSuffix(b, sep)+sep) ||
+		strings.HasPrefix(b, strings.TrimSuffix(a, sep)+sep)
+}
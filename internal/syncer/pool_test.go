@@ -0,0 +1,180 @@
+package syncer_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/client/clienttest"
+	"github.com/capcom6/sftp-sync/internal/syncer"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+func newPool(workers int) *syncer.Pool {
+	syncers := make([]*syncer.Syncer, 0, workers)
+	for range workers {
+		syncers = append(syncers, syncer.New("/root", nil, nil, syncer.Options{Compare: syncer.CompareNone}, logger.NewDefault()))
+	}
+
+	return syncer.NewPool(syncers, logger.NewDefault())
+}
+
+func TestPoolOrdersOverlappingPaths(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := newPool(4)
+	wg := sync.WaitGroup{}
+	pool.Start(ctx, &wg)
+
+	var mu sync.Mutex
+	var order []string
+	task := func(name string, delay time.Duration) syncer.Task {
+		return func(context.Context, *syncer.Syncer) {
+			time.Sleep(delay)
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+		}
+	}
+
+	// the slow upload must complete before the later removal of its parent
+	pool.Submit(task("upload", 50*time.Millisecond), "/root/a/file")
+	pool.Submit(task("other", 0), "/root/b")
+	pool.Submit(task("remove", 0), "/root/a")
+	pool.Wait()
+
+	cancel()
+	wg.Wait()
+
+	want := []string{"other", "upload", "remove"}
+	if len(order) != len(want) {
+		t.Fatalf("got %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got %v, want %v", order, want)
+		}
+	}
+}
+
+func TestPoolRunsConcurrently(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const workers = 4
+
+	pool := newPool(workers)
+	wg := sync.WaitGroup{}
+	pool.Start(ctx, &wg)
+
+	var running, peak atomic.Int32
+	for _, name := range []string{"a", "b", "c", "d"} {
+		pool.Submit(func(context.Context, *syncer.Syncer) {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			running.Add(-1)
+		}, "/root/"+name)
+	}
+	pool.Wait()
+
+	cancel()
+	wg.Wait()
+
+	if peak.Load() != workers {
+		t.Fatalf("got %d concurrent tasks, want %d", peak.Load(), workers)
+	}
+}
+
+// TestReconcileWithPoolOverFTP walks the tree while the pool uploads files
+// and handles events, every syncer on its own FTP connection.
+func TestReconcileWithPoolOverFTP(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	server := clienttest.NewFTPServer(t)
+	root := t.TempDir()
+	newSyncer := func() *syncer.Syncer {
+		upload := client.UploadOptions{Atomic: true}
+		remote := client.NewFtpClient(server.URL(), client.TLSOptions{}, upload, logger.NewDefault())
+		options := syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""}
+		return syncer.New(root, remote, nil, options, logger.NewDefault())
+	}
+
+	var want []string
+	for d := range 5 {
+		for f := range 5 {
+			name := filepath.Join(fmt.Sprintf("dir%d", d), fmt.Sprintf("file%d.txt", f))
+			writeFile(t, filepath.Join(root, name), name)
+			want = append(want, name)
+		}
+	}
+
+	walker := newSyncer()
+	pool := syncer.NewPool([]*syncer.Syncer{newSyncer(), newSyncer(), newSyncer()}, logger.NewDefault())
+	wg := sync.WaitGroup{}
+	pool.Start(ctx, &wg)
+
+	// events keep arriving during the walk
+	var events sync.WaitGroup
+	events.Add(1)
+	go func() {
+		defer events.Done()
+		for i := range 10 {
+			name := fmt.Sprintf("event%d.txt", i)
+			absPath := filepath.Join(root, "events", name)
+			writeFile(t, absPath, name)
+			pool.Submit(func(ctx context.Context, s *syncer.Syncer) {
+				if err := s.Sync(ctx, absPath); err != nil {
+					t.Errorf("Sync: %v", err)
+				}
+			}, absPath)
+		}
+	}()
+
+	stats, err := walker.Reconcile(ctx, syncer.ReconcileOptions{
+		Delete:          false,
+		DryRun:          false,
+		Pool:            pool,
+		OnFailure:       nil,
+		RemoveTempFiles: false,
+		OnRemoval:       nil,
+	})
+	events.Wait()
+	pool.Wait()
+	cancel()
+	wg.Wait()
+
+	if err != nil || stats.Failed != 0 {
+		t.Fatalf("got %+v, %v, want no failures", stats, err)
+	}
+	for _, name := range want {
+		if data, rdErr := os.ReadFile(filepath.Join(server.Root(), name)); rdErr != nil || string(data) != name {
+			t.Fatalf("got %q, %v for %s", data, rdErr, name)
+		}
+	}
+	for i := range 10 {
+		name := fmt.Sprintf("event%d.txt", i)
+		if data, rdErr := os.ReadFile(filepath.Join(server.Root(), "events", name)); rdErr != nil || string(data) != name {
+			t.Fatalf("got %q, %v for %s", data, rdErr, name)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package syncer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+	logger "github.com/go-core-fx/cli-logger"
+	"github.com/samber/lo"
+)
+
+// ReconcileOptions controls the full reconciliation pass.
+type ReconcileOptions struct {
+	// Delete removes remote entries which don't exist locally.
+	Delete bool
+	// DryRun only logs the actions without applying them.
+	DryRun bool
+	// Pool compares and uploads files concurrently if set. The tree is still
+	// walked by the syncer itself.
+	Pool *Pool
+	// OnFailure is called for every entry which failed to reconcile, if set.
+	// It's called by the workers of the pool concurrently.
+	OnFailure func(relPath string, err error)
+	// RemoveTempFiles removes leftovers of interrupted atomic uploads. It
+	// must be set only while no upload is in flight, e.g. on the initial pass.
+	RemoveTempFiles bool
+	// OnRemoval, if set, is passed the extraneous entries instead of removing
+	// them, with the number of remote entries each covers, so the caller can
+	// hold back mass removals. It's called by the walker only.
+	OnRemoval func(relPath string, entries int)
+}
+
+// Stats summarizes the result of the reconciliation pass.
+type Stats struct {
+	Uploaded  int
+	Created   int
+	Removed   int
+	UpToDate  int
+	Failed    int
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// reconcileState is shared by the walker and the workers of the pool.
+type reconcileState struct {
+	mu    sync.Mutex
+	stats Stats
+	// err is the first permanent error of a worker
+	err error
+
+	onFailure func(relPath string, err error)
+}
+
+func (r *reconcileState) inc(counter *int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	*counter++
+}
+
+func (r *reconcileState) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reconcileState) failed() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// Reconcile walks the whole source tree and brings the remote in line with
+// it: missing or different files are uploaded, missing directories are
+// created and, when requested, extraneous remote entries are removed.
+//
+// Failures of individual entries are logged and counted, so a single broken
+// file doesn't stop the pass. An error is returned only if the pass can't
+// continue at all.
+func (s *Syncer) Reconcile(ctx context.Context, opts ReconcileOptions) (Stats, error) {
+	state := &reconcileState{
+		mu: sync.Mutex{},
+		stats: Stats{
+			Uploaded:  0,
+			Created:   0,
+			Removed:   0,
+			UpToDate:  0,
+			Failed:    0,
+			StartedAt: time.Now(),
+			Duration:  0,
+		},
+		err: nil,
+
+		onFailure: opts.OnFailure,
+	}
+
+	absRoot, err := filepath.Abs(s.rootPath)
+	if err != nil {
+		return state.stats, fmt.Errorf("filepath.Abs: %w", err)
+	}
+
+	err = s.reconcileDir(ctx, absRoot, "", opts, state)
+	if opts.Pool != nil {
+		opts.Pool.Wait()
+	}
+	if err == nil {
+		err = state.failed()
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	stats := state.stats
+	stats.Duration = time.Since(stats.StartedAt)
+
+	return stats, err
+}
+
+func (s *Syncer) reconcileDir(
+	ctx context.Context,
+	absPath, relPath string,
+	opts ReconcileOptions,
+	state *reconcileState,
+) error {
+	remoteEntries, err := s.client.List(ctx, pathNormalize(relPath))
+	if err != nil {
+		return s.reconcileFailed(ctx, relPath, fmt.Errorf("c.List: %w", err), state)
+	}
+	if opts.RemoveTempFiles {
+		remoteEntries, err = s.removeStaleTempFiles(ctx, absPath, relPath, remoteEntries, opts, state)
+		if err != nil {
+			return err
+		}
+	}
+	remote := lo.SliceToMap(remoteEntries, func(e client.Entry) (string, client.Entry) {
+		return e.Name, e
+	})
+
+	files, err := os.ReadDir(absPath)
+	if err != nil {
+		return s.reconcileFailed(ctx, relPath, fmt.Errorf("os.ReadDir: %w", err), state)
+	}
+
+	local := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if wErr := state.failed(); wErr != nil {
+			return wErr
+		}
+
+		local[file.Name()] = struct{}{}
+
+		childAbsPath := filepath.Join(absPath, file.Name())
+		childRelPath := filepath.Join(relPath, file.Name())
+		if matched, rule := s.isExcluded(childAbsPath); matched {
+			s.logger.Debug(ctx, "Excluded path skipped", logger.Fields{
+				fieldPath: childRelPath,
+				"rule":    rule,
+			})
+			continue
+		}
+
+		entry, exists := remote[file.Name()]
+
+		var childErr error
+		if file.IsDir() {
+			childErr = s.reconcileChildDir(ctx, childAbsPath, childRelPath, entry, exists, opts, state)
+		} else {
+			childErr = s.submitReconcileFile(ctx, childAbsPath, childRelPath, entry, exists, opts, state)
+		}
+		if childErr != nil {
+			return childErr
+		}
+	}
+
+	if !opts.Delete {
+		return nil
+	}
+
+	for _, entry := range remoteEntries {
+		if _, ok := local[entry.Name]; ok {
+			continue
+		}
+
+		childRelPath := filepath.Join(relPath, entry.Name)
+		if matched, _ := s.isExcluded(filepath.Join(absPath, entry.Name)); matched {
+			// excluded entries are not managed by us
+			continue
+		}
+
+		if opts.OnRemoval != nil && !opts.DryRun {
+			n, cntErr := s.countRemote(ctx, childRelPath, entry)
+			if cntErr != nil {
+				if fErr := s.reconcileFailed(ctx, childRelPath, cntErr, state); fErr != nil {
+					return fErr
+				}
+				continue
+			}
+			opts.OnRemoval(childRelPath, n)
+			continue
+		}
+
+		action, done := "remove", "Removed"
+		if s.options.TrashDir != "" {
+			action, done = "move to trash", "Moved to trash"
+		}
+		if rmErr := s.reconcileApply(ctx, childRelPath, action, done, opts, func() error {
+			_, err := s.remove(ctx, childRelPath)
+			return err
+		}); rmErr != nil {
+			if fErr := s.reconcileFailed(ctx, childRelPath, rmErr, state); fErr != nil {
+				return fErr
+			}
+			continue
+		}
+		state.inc(&state.stats.Removed)
+	}
+
+	return nil
+}
+
+// countRemote returns the number of remote entries the entry covers, itself
+// included.
+func (s *Syncer) countRemote(ctx context.Context, relPath string, entry client.Entry) (int, error) {
+	if entry.Type != client.EntryTypeDir {
+		return 1, nil
+	}
+
+	children, err := s.client.List(ctx, pathNormalize(relPath))
+	if err != nil {
+		return 0, fmt.Errorf("c.List: %w", err)
+	}
+
+	count := 1
+	for _, child := range children {
+		n, cErr := s.countRemote(ctx, filepath.Join(relPath, child.Name), child)
+		if cErr != nil {
+			return count, cErr
+		}
+		count += n
+	}
+
+	return count, nil
+}
+
+// removeStaleTempFiles removes leftovers of interrupted atomic uploads and
+// returns the rest of the entries. It must run before any upload into the
+// directory is started.
+func (s *Syncer) removeStaleTempFiles(
+	ctx context.Context,
+	absPath, relPath string,
+	entries []client.Entry,
+	opts ReconcileOptions,
+	state *reconcileState,
+) ([]client.Entry, error) {
+	rest := make([]client.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type != client.EntryTypeFile || !client.IsTempName(entry.Name) {
+			rest = append(rest, entry)
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(absPath, entry.Name)); err == nil {
+			// a local file with the same name, not ours
+			rest = append(rest, entry)
+			continue
+		}
+
+		childRelPath := filepath.Join(relPath, entry.Name)
+		if rmErr := s.reconcileApply(ctx, childRelPath, "remove", "Removed stale temporary file", opts, func() error {
+			if err := s.client.RemoveFile(ctx, pathNormalize(childRelPath)); err != nil {
+				return fmt.Errorf("c.RemoveFile: %w", err)
+			}
+			return nil
+		}); rmErr != nil {
+			if fErr := s.reconcileFailed(ctx, childRelPath, rmErr, state); fErr != nil {
+				return nil, fErr
+			}
+			continue
+		}
+		state.inc(&state.stats.Removed)
+	}
+
+	return rest, nil
+}
+
+// RemoveTempFiles removes leftovers of interrupted atomic uploads from the
+// whole remote tree and returns their number. Reconcile does the same while
+// walking, so it's meant for runs without a full pass.
+func (s *Syncer) RemoveTempFiles(ctx context.Context) (int, error) {
+	absRoot, err := filepath.Abs(s.rootPath)
+	if err != nil {
+		return 0, fmt.Errorf("filepath.Abs: %w", err)
+	}
+
+	return s.removeTempFiles(ctx, absRoot, "")
+}
+
+func (s *Syncer) removeTempFiles(ctx context.Context, absPath, relPath string) (int, error) {
+	entries, err := s.client.List(ctx, pathNormalize(relPath))
+	if err != nil {
+		return 0, fmt.Errorf("c.List: %w", err)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return removed, ctx.Err()
+		}
+
+		childAbsPath := filepath.Join(absPath, entry.Name)
+		childRelPath := filepath.Join(relPath, entry.Name)
+		if matched, _ := s.isExcluded(childAbsPath); matched {
+			continue
+		}
+
+		if entry.Type == client.EntryTypeDir {
+			n, dirErr := s.removeTempFiles(ctx, childAbsPath, childRelPath)
+			removed += n
+			if dirErr != nil {
+				return removed, dirErr
+			}
+			continue
+		}
+
+		if entry.Type != client.EntryTypeFile || !client.IsTempName(entry.Name) {
+			continue
+		}
+		if _, statErr := os.Lstat(childAbsPath); statErr == nil {
+			// a local file with the same name, not ours
+			continue
+		}
+
+		if rmErr := s.client.RemoveFile(ctx, pathNormalize(childRelPath)); rmErr != nil {
+			return removed, fmt.Errorf("c.RemoveFile: %w", rmErr)
+		}
+		removed++
+
+		s.logger.Info(ctx, "Removed stale temporary file", logger.Fields{fieldPath: childRelPath})
+	}
+
+	return removed, nil
+}
+
+func (s *Syncer) reconcileChildDir(
+	ctx context.Context,
+	absPath, relPath string,
+	entry client.Entry,
+	exists bool,
+	opts ReconcileOptions,
+	state *reconcileState,
+) error {
+	if !exists || entry.Type != client.EntryTypeDir {
+		if err := s.reconcileApply(ctx, relPath, "create", "Created", opts, func() error {
+			if exists {
+				if _, err := s.remove(ctx, relPath); err != nil {
+					return err
+				}
+			}
+			if err := s.client.MakeDir(ctx, pathNormalize(relPath)); err != nil {
+				return fmt.Errorf("c.MakeDir: %w", err)
+			}
+			return nil
+		}); err != nil {
+			return s.reconcileFailed(ctx, relPath, err, state)
+		}
+		state.inc(&state.stats.Created)
+
+		if opts.DryRun {
+			// there is nothing to compare with on the remote side
+			nested := opts
+			nested.Delete = false
+			return s.reconcileDir(ctx, absPath, relPath, nested, state)
+		}
+	}
+
+	return s.reconcileDir(ctx, absPath, relPath, opts, state)
+}
+
+// submitReconcileFile reconciles the file by a worker of the pool if any.
+func (s *Syncer) submitReconcileFile(
+	ctx context.Context,
+	absPath, relPath string,
+	entry client.Entry,
+	exists bool,
+	opts ReconcileOptions,
+	state *reconcileState,
+) error {
+	if opts.Pool == nil {
+		return s.reconcileFile(ctx, absPath, relPath, entry, exists, opts, state)
+	}
+
+	opts.Pool.Submit(func(ctx context.Context, w *Syncer) {
+		if state.failed() != nil {
+			return
+		}
+		if err := w.reconcileFile(ctx, absPath, relPath, entry, exists, opts, state); err != nil {
+			state.fail(err)
+		}
+	}, absPath)
+
+	return nil
+}
+
+func (s *Syncer) reconcileFile(
+	ctx context.Context,
+	absPath, relPath string,
+	entry client.Entry,
+	exists bool,
+	opts ReconcileOptions,
+	state *reconcileState,
+) error {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return s.reconcileFailed(ctx, relPath, fmt.Errorf("os.Stat: %w", err), state)
+	}
+
+	if exists {
+		if unchanged, reason := s.isUnchanged(ctx, absPath, relPath, info, entry, false); unchanged {
+			s.logger.Debug(ctx, "Up to date", logger.Fields{
+				fieldPath: relPath,
+				"reason":  reason,
+			})
+			state.inc(&state.stats.UpToDate)
+			return nil
+		}
+	}
+
+	if upErr := s.reconcileApply(ctx, relPath, "upload", "Uploaded", opts, func() error {
+		if exists && entry.Type == client.EntryTypeDir {
+			if _, rmErr := s.remove(ctx, relPath); rmErr != nil {
+				return rmErr
+			}
+		}
+		if ulErr := s.client.UploadFile(ctx, pathNormalize(relPath), pathNormalize(absPath)); ulErr != nil {
+			return fmt.Errorf("c.UploadFile: %w", ulErr)
+		}
+		return nil
+	}); upErr != nil {
+		return s.reconcileFailed(ctx, relPath, upErr, state)
+	}
+	state.inc(&state.stats.Uploaded)
+
+	return nil
+}
+
+// reconcileApply runs the action or only logs it in dry run mode.
+func (s *Syncer) reconcileApply(
+	ctx context.Context,
+	relPath, action, done string,
+	opts ReconcileOptions,
+	apply func() error,
+) error {
+	if opts.DryRun {
+		s.logger.Info(ctx, "Would "+action, logger.Fields{fieldPath: relPath})
+		return nil
+	}
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	s.logger.Info(ctx, done, logger.Fields{fieldPath: relPath})
+
+	return nil
+}
+
+// reconcileFailed counts the failure and decides whether the pass may continue.
+func (s *Syncer) reconcileFailed(ctx context.Context, relPath string, err error, state *reconcileState) error {
+	if ctx.Err() != nil {
+		return nil //nolint:nilerr // cancellation is not a failure
+	}
+
+	if client.IsPermanent(err) {
+		return err
+	}
+
+	state.inc(&state.stats.Failed)
+	s.logger.Error(ctx, "Failed to reconcile", err, logger.Fields{fieldPath: relPath})
+	if state.onFailure != nil {
+		state.onFailure(relPath, err)
+	}
+
+	return nil
+}
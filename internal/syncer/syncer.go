@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
 
 	"github.com/capcom6/sftp-sync/internal/client"
 	"github.com/capcom6/sftp-sync/internal/exclude"
@@ -16,33 +18,56 @@ const (
 	fieldPath = "path"
 )
 
+// Options tunes the behavior of the syncer.
+type Options struct {
+	// Compare selects how to detect files which don't need to be uploaded.
+	Compare CompareStrategy
+	// TrashDir is the remote directory, relative to the destination root,
+	// which keeps removed entries instead of deleting them. Empty to delete.
+	TrashDir string
+}
+
 type Syncer struct {
 	rootPath string
 	client   client.Client
 	matcher  *exclude.Matcher
+	options  Options
 
 	logger logger.Logger
+
+	// preserves caches whether the client keeps modification times
+	preserves  *bool
+	preserveMu sync.Mutex
 }
 
-func New(rootPath string, client client.Client, matcher *exclude.Matcher, logger logger.Logger) *Syncer {
+func New(
+	rootPath string,
+	client client.Client,
+	matcher *exclude.Matcher,
+	options Options,
+	logger logger.Logger,
+) *Syncer {
+	if options.TrashDir != "" {
+		options.TrashDir = path.Clean(filepath.ToSlash(options.TrashDir))
+	}
+
 	return &Syncer{
 		rootPath: rootPath,
 		client:   client,
 		matcher:  matcher,
+		options:  options,
 
 		logger: logger.WithContext("syncer", ""),
+
+		preserves:  nil,
+		preserveMu: sync.Mutex{},
 	}
 }
 
 func (s *Syncer) Sync(ctx context.Context, absPath string) error {
-	absRoot, err := filepath.Abs(s.rootPath)
-	if err != nil {
-		return fmt.Errorf("filepath.Abs: %w", err)
-	}
-
-	relPath, err := filepath.Rel(absRoot, absPath)
+	relPath, err := s.relPath(absPath)
 	if err != nil {
-		return fmt.Errorf("filepath.Rel: %w", err)
+		return err
 	}
 
 	if matched, rule := s.isExcluded(absPath); matched {
@@ -59,13 +84,12 @@ func (s *Syncer) Sync(ctx context.Context, absPath string) error {
 	}
 
 	if !exists {
-		if rmErr := s.client.Remove(ctx, pathNormalize(relPath)); rmErr != nil {
-			return fmt.Errorf("c.Remove: %w", rmErr)
+		trashPath, rmErr := s.remove(ctx, relPath)
+		if rmErr != nil {
+			return rmErr
 		}
 
-		s.logger.Info(ctx, "Removed", logger.Fields{
-			fieldPath: relPath,
-		})
+		s.logRemoved(ctx, relPath, trashPath)
 
 		return nil
 	}
@@ -77,15 +101,123 @@ func (s *Syncer) Sync(ctx context.Context, absPath string) error {
 	return s.syncFile(ctx, absPath, relPath)
 }
 
+// SyncRename moves the remote entry after a rename within the source tree.
+// If it can't be renamed, or the remote entry doesn't look like the renamed
+// one, the old name is removed and the new one uploaded.
+func (s *Syncer) SyncRename(ctx context.Context, oldAbsPath, newAbsPath string) error {
+	oldRelPath, err := s.relPath(oldAbsPath)
+	if err != nil {
+		return err
+	}
+	newRelPath, err := s.relPath(newAbsPath)
+	if err != nil {
+		return err
+	}
+
+	if oldExcluded, _ := s.isExcluded(oldAbsPath); oldExcluded {
+		return s.Sync(ctx, newAbsPath)
+	}
+	if newExcluded, _ := s.isExcluded(newAbsPath); newExcluded {
+		return s.Sync(ctx, oldAbsPath)
+	}
+
+	exists, isDir, err := fsInfo(newAbsPath)
+	if err != nil {
+		return fmt.Errorf("fsInfo: %w", err)
+	}
+	if !exists {
+		return s.syncBoth(ctx, oldAbsPath, newAbsPath)
+	}
+
+	remote, stErr := s.client.Stat(ctx, pathNormalize(oldRelPath))
+	if stErr != nil {
+		if !errors.Is(stErr, client.ErrNotFound) {
+			return fmt.Errorf("c.Stat: %w", stErr)
+		}
+		// nothing to rename on the remote
+		return s.Sync(ctx, newAbsPath)
+	}
+	if !s.isRenameOf(newAbsPath, isDir, remote) {
+		return s.syncBoth(ctx, oldAbsPath, newAbsPath)
+	}
+
+	if rnErr := s.client.Rename(ctx, pathNormalize(oldRelPath), pathNormalize(newRelPath)); rnErr != nil {
+		if client.IsPermanent(rnErr) {
+			return fmt.Errorf("c.Rename: %w", rnErr)
+		}
+
+		s.logger.Warn(ctx, "Failed to rename, uploading instead", logger.Fields{
+			fieldPath: newRelPath,
+			"from":    oldRelPath,
+			"error":   rnErr,
+		})
+		return s.syncBoth(ctx, oldAbsPath, newAbsPath)
+	}
+
+	s.logger.Info(ctx, "Renamed", logger.Fields{
+		fieldPath: newRelPath,
+		"from":    oldRelPath,
+	})
+
+	// the content might have been changed along with the name
+	if isDir {
+		return s.syncEntries(ctx, newAbsPath, newRelPath)
+	}
+
+	return s.syncFile(ctx, newAbsPath, newRelPath)
+}
+
+// isRenameOf reports whether the remote entry may be the renamed local one.
+// Otherwise the events were paired wrongly, and renaming the entry would
+// move unrelated content.
+func (s *Syncer) isRenameOf(absPath string, isDir bool, remote client.Entry) bool {
+	if isDir {
+		return remote.Type == client.EntryTypeDir
+	}
+	if remote.Type != client.EntryTypeFile {
+		return false
+	}
+
+	info, err := os.Stat(absPath)
+
+	return err == nil && info.Size() == remote.Size
+}
+
+// Probe checks whether the destination is reachable. Any answer of the server,
+// even an error, means it is.
+func (s *Syncer) Probe(ctx context.Context) error {
+	if _, err := s.client.Stat(ctx, "."); client.IsUnreachable(err) {
+		return fmt.Errorf("s.client.Stat: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Syncer) syncBoth(ctx context.Context, oldAbsPath, newAbsPath string) error {
+	if err := s.Sync(ctx, oldAbsPath); err != nil {
+		return err
+	}
+
+	return s.Sync(ctx, newAbsPath)
+}
+
 func (s *Syncer) syncFile(ctx context.Context, absPath, relPath string) error {
-	if err := s.client.UploadFile(ctx, pathNormalize(relPath), pathNormalize(absPath)); err != nil {
-		return fmt.Errorf("c.UploadFile: %w", err)
+	unchanged, err := s.isRemoteUnchanged(ctx, absPath, relPath)
+	if err != nil {
+		return err
+	}
+	if unchanged {
+		return nil
+	}
+
+	if upErr := s.client.UploadFile(ctx, pathNormalize(relPath), pathNormalize(absPath)); upErr != nil {
+		return fmt.Errorf("c.UploadFile: %w", upErr)
 	}
 
 	fields := logger.Fields{
 		fieldPath: relPath,
 	}
-	if info, err := os.Stat(absPath); err == nil {
+	if info, stErr := os.Stat(absPath); stErr == nil {
 		fields["size"] = info.Size()
 	}
 	s.logger.Info(ctx, "Uploaded", fields)
@@ -93,6 +225,37 @@ func (s *Syncer) syncFile(ctx context.Context, absPath, relPath string) error {
 	return nil
 }
 
+// isRemoteUnchanged checks whether the upload can be skipped because the
+// remote file is already identical.
+func (s *Syncer) isRemoteUnchanged(ctx context.Context, absPath, relPath string) (bool, error) {
+	if s.options.Compare == CompareNone {
+		return false, nil
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return false, fmt.Errorf("os.Stat: %w", err)
+	}
+
+	remote, err := s.client.Stat(ctx, pathNormalize(relPath))
+	if errors.Is(err, client.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("c.Stat: %w", err)
+	}
+
+	unchanged, reason := s.isUnchanged(ctx, absPath, relPath, info, remote, true)
+	if unchanged {
+		s.logger.Debug(ctx, "Unchanged file skipped", logger.Fields{
+			fieldPath: relPath,
+			"reason":  reason,
+		})
+	}
+
+	return unchanged, nil
+}
+
 func (s *Syncer) syncDir(ctx context.Context, absPath, relPath string) error {
 	if err := s.client.MakeDir(ctx, pathNormalize(relPath)); err != nil {
 		return fmt.Errorf("c.MakeDir: %w", err)
@@ -101,6 +264,11 @@ func (s *Syncer) syncDir(ctx context.Context, absPath, relPath string) error {
 		fieldPath: relPath,
 	})
 
+	return s.syncEntries(ctx, absPath, relPath)
+}
+
+// syncEntries syncs the content of the existing remote directory.
+func (s *Syncer) syncEntries(ctx context.Context, absPath, relPath string) error {
 	files, err := os.ReadDir(absPath)
 	if err != nil {
 		return fmt.Errorf("os.ReadDir: %w", err)
@@ -138,6 +306,20 @@ func (s *Syncer) syncDir(ctx context.Context, absPath, relPath string) error {
 	return nil
 }
 
+func (s *Syncer) relPath(absPath string) (string, error) {
+	absRoot, err := filepath.Abs(s.rootPath)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Abs: %w", err)
+	}
+
+	relPath, err := filepath.Rel(absRoot, absPath)
+	if err != nil {
+		return "", fmt.Errorf("filepath.Rel: %w", err)
+	}
+
+	return relPath, nil
+}
+
 func fsInfo(path string) (bool, bool, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
@@ -155,6 +337,10 @@ func pathNormalize(path string) string {
 }
 
 func (s *Syncer) isExcluded(absPath string) (bool, string) {
+	if relPath, err := s.relPath(absPath); err == nil && s.inTrash(relPath) {
+		return true, "trash"
+	}
+
 	if s.matcher == nil {
 		return false, ""
 	}
@@ -0,0 +1,360 @@
+package syncer_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+	"github.com/capcom6/sftp-sync/internal/client/clienttest"
+	"github.com/capcom6/sftp-sync/internal/syncer"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+func newSyncer(t *testing.T, options syncer.Options) (*syncer.Syncer, *clienttest.Memory, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	remote := clienttest.NewMemory()
+
+	return syncer.New(root, remote, nil, options, logger.NewDefault()), remote, root
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countOps(ops []clienttest.Op, name string) int {
+	n := 0
+	for _, op := range ops {
+		if op.Name == name {
+			n++
+		}
+	}
+
+	return n
+}
+
+func assertPaths(t *testing.T, remote *clienttest.Memory, want ...string) {
+	t.Helper()
+
+	if got := remote.Paths(); !slices.Equal(got, want) {
+		t.Fatalf("got remote %v, want %v", got, want)
+	}
+}
+
+func TestSyncUploadsAndRemoves(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareNone, TrashDir: ""})
+	writeFile(t, filepath.Join(root, "site", "css", "main.css"), "body{}")
+	writeFile(t, filepath.Join(root, "site", "index.html"), "hello")
+
+	if err := s.Sync(t.Context(), filepath.Join(root, "site")); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	assertPaths(t, remote, "site/", "site/css/", "site/css/main.css", "site/index.html")
+	if data, _ := remote.ReadFile("site/index.html"); string(data) != "hello" {
+		t.Fatalf("got %q, want %q", data, "hello")
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "site", "css")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(t.Context(), filepath.Join(root, "site", "css")); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	assertPaths(t, remote, "site/", "site/index.html")
+}
+
+func TestSyncSkipsUnchangedFiles(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""})
+	localPath := filepath.Join(root, "index.html")
+	writeFile(t, localPath, "hello")
+
+	for range 2 {
+		if err := s.Sync(t.Context(), localPath); err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+	}
+	if n := countOps(remote.Ops(), clienttest.OpUploadFile); n != 1 {
+		t.Fatalf("got %d uploads, want 1", n)
+	}
+
+	// a remote file of another size is replaced
+	remote.WriteFile("index.html", []byte("stale content"), time.Now())
+	if err := s.Sync(t.Context(), localPath); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if data, _ := remote.ReadFile("index.html"); string(data) != "hello" {
+		t.Fatalf("got %q, want %q", data, "hello")
+	}
+}
+
+func TestSyncUploadsSameSizeEdits(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""})
+	localPath := filepath.Join(root, "index.html")
+	writeFile(t, localPath, "hello")
+
+	// the server clock is ahead, but the backend preserves times, so only
+	// equal times are trusted
+	remote.WriteFile("index.html", []byte("hallo"), time.Now().Add(time.Hour))
+	if err := s.Sync(t.Context(), localPath); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if data, _ := remote.ReadFile("index.html"); string(data) != "hello" {
+		t.Fatalf("got %q, want %q", data, "hello")
+	}
+}
+
+func TestSyncTrustsUploadTimesOnlyOnReconcile(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	remote := clienttest.NewMemory()
+	// hides PreservesModTime of the memory client
+	plain := struct{ client.Client }{remote}
+	s := syncer.New(root, plain, nil, syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""}, logger.NewDefault())
+
+	localPath := filepath.Join(root, "index.html")
+	writeFile(t, localPath, "hello")
+	remote.WriteFile("index.html", []byte("hallo"), time.Now().Add(time.Hour))
+
+	stats, err := s.Reconcile(t.Context(), syncer.ReconcileOptions{
+		Delete:          false,
+		DryRun:          false,
+		Pool:            nil,
+		OnFailure:       nil,
+		RemoveTempFiles: false,
+		OnRemoval:       nil,
+	})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if stats.UpToDate != 1 {
+		t.Fatalf("got %+v, want the newer remote file to be up to date", stats)
+	}
+
+	// the watcher reported the change, so it's uploaded
+	if syncErr := s.Sync(t.Context(), localPath); syncErr != nil {
+		t.Fatalf("Sync: %v", syncErr)
+	}
+	if data, _ := remote.ReadFile("index.html"); string(data) != "hello" {
+		t.Fatalf("got %q, want %q", data, "hello")
+	}
+}
+
+func TestSyncReturnsClientErrors(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareNone, TrashDir: ""})
+	localPath := filepath.Join(root, "index.html")
+	writeFile(t, localPath, "hello")
+
+	remote.Fail(clienttest.OpUploadFile, "index.html", client.ErrUnreachable, 1)
+
+	err := s.Sync(t.Context(), localPath)
+	if !client.IsUnreachable(err) {
+		t.Fatalf("got %v, want an unreachable error", err)
+	}
+	assertPaths(t, remote)
+
+	// the fault is gone after a single call
+	if syncErr := s.Sync(t.Context(), localPath); syncErr != nil {
+		t.Fatalf("Sync: %v", syncErr)
+	}
+	assertPaths(t, remote, "index.html")
+}
+
+func TestSyncStopsOnCancel(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareNone, TrashDir: ""})
+	localPath := filepath.Join(root, "index.html")
+	writeFile(t, localPath, "hello")
+
+	remote.SetLatency(time.Minute)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := s.Sync(ctx, localPath); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSyncRenameMovesRemoteEntry(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""})
+	writeFile(t, filepath.Join(root, "old", "index.html"), "hello")
+	if err := s.Sync(t.Context(), filepath.Join(root, "old")); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	remote.ResetOps()
+
+	if err := os.Rename(filepath.Join(root, "old"), filepath.Join(root, "new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SyncRename(t.Context(), filepath.Join(root, "old"), filepath.Join(root, "new")); err != nil {
+		t.Fatalf("SyncRename: %v", err)
+	}
+
+	assertPaths(t, remote, "new/", "new/index.html")
+	if n := countOps(remote.Ops(), clienttest.OpUploadFile); n != 0 {
+		t.Fatalf("got %d uploads, want the entry to be renamed", n)
+	}
+}
+
+func TestSyncRenameSyncsRenamedDirContent(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""})
+	writeFile(t, filepath.Join(root, "old", "index.html"), "hello")
+	if err := s.Sync(t.Context(), filepath.Join(root, "old")); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	if err := os.Rename(filepath.Join(root, "old"), filepath.Join(root, "new")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "new", "about.html"), "about")
+	if err := s.SyncRename(t.Context(), filepath.Join(root, "old"), filepath.Join(root, "new")); err != nil {
+		t.Fatalf("SyncRename: %v", err)
+	}
+
+	assertPaths(t, remote, "new/", "new/about.html", "new/index.html")
+}
+
+func TestSyncRenameFallsBackOnMismatch(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""})
+	// the old name on the remote is an unrelated file
+	remote.WriteFile("old.html", []byte("something else"), time.Now())
+	writeFile(t, filepath.Join(root, "new.html"), "hello")
+
+	if err := s.SyncRename(t.Context(), filepath.Join(root, "old.html"), filepath.Join(root, "new.html")); err != nil {
+		t.Fatalf("SyncRename: %v", err)
+	}
+
+	assertPaths(t, remote, "new.html")
+	if data, _ := remote.ReadFile("new.html"); string(data) != "hello" {
+		t.Fatalf("got %q, want %q", data, "hello")
+	}
+	if n := countOps(remote.Ops(), clienttest.OpRename); n != 0 {
+		t.Fatalf("got %d renames, want none", n)
+	}
+}
+
+func TestSyncMovesRemovedEntriesToTrash(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareNone, TrashDir: ".trash"})
+	remote.WriteFile("index.html", []byte("hello"), time.Now())
+
+	if err := s.Sync(t.Context(), filepath.Join(root, "index.html")); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	paths := remote.Paths()
+	if len(paths) != 3 || !strings.HasPrefix(paths[2], ".trash/") || !strings.HasSuffix(paths[2], "/index.html") {
+		t.Fatalf("got remote %v, want index.html in a trash snapshot", paths)
+	}
+}
+
+func TestReconcileDeletesExtraneousEntries(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""})
+	writeFile(t, filepath.Join(root, "index.html"), "hello")
+	writeFile(t, filepath.Join(root, "css", "main.css"), "body{}")
+	info, err := os.Stat(filepath.Join(root, "css", "main.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote.WriteFile("css/main.css", []byte("body{}"), info.ModTime())
+	remote.WriteFile("old/page.html", []byte("bye"), time.Now())
+
+	stats, err := s.Reconcile(t.Context(), syncer.ReconcileOptions{
+		Delete:          true,
+		DryRun:          false,
+		Pool:            nil,
+		OnFailure:       nil,
+		RemoveTempFiles: false,
+		OnRemoval:       nil,
+	})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	assertPaths(t, remote, "css/", "css/main.css", "index.html")
+	if stats.Uploaded != 1 || stats.UpToDate != 1 || stats.Removed != 1 || stats.Failed != 0 {
+		t.Fatalf("got %+v, want 1 uploaded, 1 up to date and 1 removed", stats)
+	}
+}
+
+func TestRemoveTempFilesWithoutReconcile(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareNone, TrashDir: ".trash"})
+	writeFile(t, filepath.Join(root, "css", ".local.sftp-sync.tmp"), "local")
+	remote.WriteFile("index.html", []byte("hello"), time.Now())
+	remote.WriteFile(".index.html.sftp-sync.tmp", []byte("hel"), time.Now())
+	remote.WriteFile("css/.main.css.sftp-sync.tmp", []byte("bo"), time.Now())
+	remote.WriteFile("css/.local.sftp-sync.tmp", []byte("local"), time.Now())
+	remote.WriteFile(".trash/snapshot/.old.sftp-sync.tmp", []byte("old"), time.Now())
+
+	removed, err := s.RemoveTempFiles(t.Context())
+	if err != nil {
+		t.Fatalf("RemoveTempFiles: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("got %d removed, want 2", removed)
+	}
+	assertPaths(t, remote,
+		".trash/", ".trash/snapshot/", ".trash/snapshot/.old.sftp-sync.tmp",
+		"css/", "css/.local.sftp-sync.tmp", "index.html")
+}
+
+func TestReconcileRemovesTempFilesOnlyWhenAsked(t *testing.T) {
+	t.Parallel()
+
+	s, remote, root := newSyncer(t, syncer.Options{Compare: syncer.CompareSizeMtime, TrashDir: ""})
+	writeFile(t, filepath.Join(root, "index.html"), "hello")
+	remote.WriteFile(".index.html.sftp-sync.tmp", []byte("hel"), time.Now())
+
+	for _, removeTempFiles := range []bool{false, true} {
+		if _, err := s.Reconcile(t.Context(), syncer.ReconcileOptions{
+			Delete:          false,
+			DryRun:          false,
+			Pool:            nil,
+			OnFailure:       nil,
+			RemoveTempFiles: removeTempFiles,
+			OnRemoval:       nil,
+		}); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+
+		_, kept := remote.ReadFile(".index.html.sftp-sync.tmp")
+		if kept == removeTempFiles {
+			t.Fatalf("got temporary file kept %v with RemoveTempFiles %v", kept, removeTempFiles)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/client"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+// snapshotLayout names the trash directory of the entries removed at the same
+// second, so the names sort by time.
+const snapshotLayout = "20060102-150405"
+
+// TrashEntry is a file or an empty directory kept in the trash.
+type TrashEntry struct {
+	// Snapshot is the name of the trash directory the entry was moved to.
+	Snapshot string
+	// RemovedAt is the time encoded in the snapshot name.
+	RemovedAt time.Time
+	// Path is the path of the entry relative to the destination root.
+	Path string
+	Type client.EntryType
+	Size int64
+}
+
+// remove deletes the remote entry or moves it to the trash directory when
+// one is configured. It returns the path in the trash, if any.
+func (s *Syncer) remove(ctx context.Context, relPath string) (string, error) {
+	remotePath := pathNormalize(relPath)
+	if s.options.TrashDir == "" {
+		if err := s.client.Remove(ctx, remotePath); err != nil {
+			return "", fmt.Errorf("c.Remove: %w", err)
+		}
+		return "", nil
+	}
+
+	entry, err := s.client.Stat(ctx, remotePath)
+	if errors.Is(err, client.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("c.Stat: %w", err)
+	}
+
+	snapshot := time.Now().UTC().Format(snapshotLayout)
+	trashPath := path.Join(s.options.TrashDir, snapshot, remotePath)
+	if mvErr := s.moveMerge(ctx, remotePath, trashPath, entry.Type); mvErr != nil {
+		return "", mvErr
+	}
+
+	return trashPath, nil
+}
+
+func (s *Syncer) logRemoved(ctx context.Context, relPath, trashPath string) {
+	if trashPath == "" {
+		s.logger.Info(ctx, "Removed", logger.Fields{
+			fieldPath: relPath,
+		})
+		return
+	}
+
+	s.logger.Info(ctx, "Moved to trash", logger.Fields{
+		fieldPath: relPath,
+		"trash":   trashPath,
+	})
+}
+
+// moveMerge renames the entry. A directory moved onto an existing one is
+// merged into it, e.g. when its files were trashed a moment before.
+func (s *Syncer) moveMerge(ctx context.Context, fromPath, toPath string, entryType client.EntryType) error {
+	if entryType == client.EntryTypeDir {
+		target, err := s.client.Stat(ctx, toPath)
+		if err != nil && !errors.Is(err, client.ErrNotFound) {
+			return fmt.Errorf("c.Stat: %w", err)
+		}
+		if err == nil && target.Type == client.EntryTypeDir {
+			return s.merge(ctx, fromPath, toPath)
+		}
+	}
+
+	if err := s.client.Rename(ctx, fromPath, toPath); err != nil {
+		return fmt.Errorf("c.Rename: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Syncer) merge(ctx context.Context, fromDir, toDir string) error {
+	entries, err := s.client.List(ctx, fromDir)
+	if err != nil {
+		return fmt.Errorf("c.List: %w", err)
+	}
+
+	for _, entry := range entries {
+		fromPath, toPath := path.Join(fromDir, entry.Name), path.Join(toDir, entry.Name)
+		if mvErr := s.moveMerge(ctx, fromPath, toPath, entry.Type); mvErr != nil {
+			return mvErr
+		}
+	}
+
+	if rmErr := s.client.RemoveDir(ctx, fromDir); rmErr != nil {
+		return fmt.Errorf("c.RemoveDir: %w", rmErr)
+	}
+
+	return nil
+}
+
+// inTrash reports whether the relative path is the trash directory or inside
+// it, such paths are never synced.
+func (s *Syncer) inTrash(relPath string) bool {
+	if s.options.TrashDir == "" {
+		return false
+	}
+
+	p := pathNormalize(relPath)
+	return p == s.options.TrashDir || strings.HasPrefix(p, s.options.TrashDir+"/")
+}
+
+// PurgeTrash removes snapshots of the trash directory older than the
+// retention period and returns their number. A zero retention keeps the
+// trash forever.
+func (s *Syncer) PurgeTrash(ctx context.Context, retention time.Duration) (int, error) {
+	if s.options.TrashDir == "" || retention <= 0 {
+		return 0, nil
+	}
+
+	snapshots, err := s.snapshots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-retention)
+	purged := 0
+	for _, snapshot := range snapshots {
+		if ctx.Err() != nil {
+			break
+		}
+
+		removedAt, _ := parseSnapshot(snapshot)
+		if !removedAt.Before(cutoff) {
+			continue
+		}
+
+		if rmErr := s.client.RemoveDir(ctx, path.Join(s.options.TrashDir, snapshot)); rmErr != nil {
+			return purged, fmt.Errorf("c.RemoveDir: %w", rmErr)
+		}
+		purged++
+
+		s.logger.Info(ctx, "Purged trash", logger.Fields{
+			"snapshot":   snapshot,
+			"removed_at": removedAt,
+		})
+	}
+
+	return purged, nil
+}
+
+// ListTrash returns the files and empty directories of every snapshot, the
+// latest snapshots first.
+func (s *Syncer) ListTrash(ctx context.Context) ([]TrashEntry, error) {
+	snapshots, err := s.snapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []TrashEntry
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		removedAt, _ := parseSnapshot(snapshots[i])
+		entries, listErr := s.listTrashDir(ctx, snapshots[i], removedAt, "")
+		if listErr != nil {
+			return nil, listErr
+		}
+		result = append(result, entries...)
+	}
+
+	return result, nil
+}
+
+func (s *Syncer) listTrashDir(
+	ctx context.Context,
+	snapshot string,
+	removedAt time.Time,
+	dir string,
+) ([]TrashEntry, error) {
+	entries, err := s.client.List(ctx, path.Join(s.options.TrashDir, snapshot, dir))
+	if err != nil {
+		return nil, fmt.Errorf("c.List: %w", err)
+	}
+
+	result := make([]TrashEntry, 0, len(entries))
+	for _, entry := range entries {
+		entryPath := path.Join(dir, entry.Name)
+		if entry.Type == client.EntryTypeDir {
+			nested, listErr := s.listTrashDir(ctx, snapshot, removedAt, entryPath)
+			if listErr != nil {
+				return nil, listErr
+			}
+			if len(nested) > 0 {
+				result = append(result, nested...)
+				continue
+			}
+		}
+
+		result = append(result, TrashEntry{
+			Snapshot:  snapshot,
+			RemovedAt: removedAt,
+			Path:      entryPath,
+			Type:      entry.Type,
+			Size:      entry.Size,
+		})
+	}
+
+	return result, nil
+}
+
+// Restore moves the entry from the trash back to its place and returns the
+// snapshot it was taken from. The latest snapshot containing the path is used
+// unless one is given. An entry which exists in its place is moved to the
+// trash first.
+func (s *Syncer) Restore(ctx context.Context, relPath, snapshot string) (string, error) {
+	if s.options.TrashDir == "" {
+		return "", ErrTrashDisabled
+	}
+
+	remotePath := path.Clean(pathNormalize(relPath))
+	if remotePath == "." || path.IsAbs(remotePath) || strings.HasPrefix(remotePath, "../") || s.inTrash(remotePath) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRestorePath, relPath)
+	}
+
+	snapshots, err := s.snapshots(ctx)
+	if err != nil {
+		return "", err
+	}
+	if snapshot != "" {
+		if !slices.Contains(snapshots, snapshot) {
+			return "", fmt.Errorf("%w: snapshot %s", ErrNotInTrash, snapshot)
+		}
+		snapshots = []string{snapshot}
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		trashPath := path.Join(s.options.TrashDir, snapshots[i], remotePath)
+		if _, stErr := s.client.Stat(ctx, trashPath); stErr != nil {
+			if errors.Is(stErr, client.ErrNotFound) {
+				continue
+			}
+			return "", fmt.Errorf("c.Stat: %w", stErr)
+		}
+
+		if _, rmErr := s.remove(ctx, remotePath); rmErr != nil {
+			return "", rmErr
+		}
+		if rnErr := s.client.Rename(ctx, trashPath, remotePath); rnErr != nil {
+			return "", fmt.Errorf("c.Rename: %w", rnErr)
+		}
+
+		s.logger.Info(ctx, "Restored", logger.Fields{
+			fieldPath:  relPath,
+			"snapshot": snapshots[i],
+		})
+
+		return snapshots[i], nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrNotInTrash, relPath)
+}
+
+// snapshots returns the names of the trash snapshots in chronological order,
+// entries not created by us are skipped.
+func (s *Syncer) snapshots(ctx context.Context) ([]string, error) {
+	entries, err := s.client.List(ctx, s.options.TrashDir)
+	if err != nil {
+		return nil, fmt.Errorf("c.List: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type != client.EntryTypeDir {
+			continue
+		}
+		if _, ok := parseSnapshot(entry.Name); ok {
+			names = append(names, entry.Name)
+		}
+	}
+	slices.Sort(names)
+
+	return names, nil
+}
+
+func parseSnapshot(name string) (time.Time, bool) {
+	t, err := time.Parse(snapshotLayout, name)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
@@ -4,6 +4,9 @@ const (
 	EventCreated  EventType = "created"
 	EventModified EventType = "modified"
 	EventRemoved  EventType = "removed"
+	// EventRenamed is reported when an entry is renamed or moved within the
+	// tree, the old name is kept in OldAbsPath and OldRelPath.
+	EventRenamed EventType = "renamed"
 )
 
 type EventType string
@@ -13,4 +16,7 @@ type Event struct {
 	AbsPath string
 	RelPath string
 	Type    EventType
+
+	OldAbsPath string
+	OldRelPath string
 }
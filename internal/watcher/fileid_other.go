@@ -0,0 +1,10 @@
+//go:build !unix
+
+package watcher
+
+import "io/fs"
+
+// fileIDOf reports no identity, renames are paired by name then.
+func fileIDOf(_ fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package watcher
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileIDOf returns the device and inode of the entry.
+func fileIDOf(info fs.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+
+	return fileID{dev: uint64(st.Dev), ino: st.Ino, dir: false}, true //nolint:unconvert // Dev differs between systems
+}
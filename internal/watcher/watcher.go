@@ -3,16 +3,30 @@ package watcher
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/capcom6/sftp-sync/internal/exclude"
 	"github.com/fsnotify/fsnotify"
 	logger "github.com/go-core-fx/cli-logger"
 )
 
+// renameWindow is how long the old name of a renamed entry waits for the new
+// one. Both are reported by the kernel at once, so it can be short. A new
+// entry is taken as the new name only if it's the same file.
+const renameWindow = 100 * time.Millisecond
+
+// fileID identifies a file across renames.
+type fileID struct {
+	dev uint64
+	ino uint64
+	dir bool
+}
+
 type Watcher struct {
 	rootPath string
 	matcher  *exclude.Matcher
@@ -22,6 +36,16 @@ type Watcher struct {
 	absRootPath string
 	fswatcher   *fsnotify.Watcher
 	events      chan Event
+
+	// pendingRename holds the old name of a renamed entry until the new name
+	// arrives as a create event, or the entry has left the tree
+	pendingRename *Event
+	// pendingID identifies the renamed entry, if known
+	pendingID   *fileID
+	renameTimer *time.Timer
+	// ids identifies the entries of the tree by their absolute paths, the
+	// old name of a renamed entry can't be looked up anymore
+	ids map[string]fileID
 }
 
 func New(rootPath string, matcher *exclude.Matcher, logger logger.Logger) *Watcher {
@@ -34,6 +58,11 @@ func New(rootPath string, matcher *exclude.Matcher, logger logger.Logger) *Watch
 		absRootPath: "",
 		fswatcher:   nil,
 		events:      nil,
+
+		pendingRename: nil,
+		pendingID:     nil,
+		renameTimer:   nil,
+		ids:           map[string]fileID{},
 	}
 }
 
@@ -70,7 +99,13 @@ func (w *Watcher) Watch(ctx context.Context, wg *sync.WaitGroup) (EventsChannel,
 }
 
 func (w *Watcher) runWatcher(ctx context.Context) {
+	w.renameTimer = time.NewTimer(renameWindow)
+	w.renameTimer.Stop()
+
 	defer func() {
+		w.renameTimer.Stop()
+		w.pendingRename = nil
+		w.pendingID = nil
 		_ = w.fswatcher.Close()
 		close(w.events)
 		w.fswatcher = nil
@@ -84,6 +119,9 @@ func (w *Watcher) runWatcher(ctx context.Context) {
 				return
 			}
 
+			// rules have to be up to date before the event is filtered
+			w.refreshIgnoreFiles(ctx, event)
+
 			if w.isExcluded(ctx, event.Name) {
 				continue
 			}
@@ -100,6 +138,8 @@ func (w *Watcher) runWatcher(ctx context.Context) {
 				return
 			}
 			w.logger.Error(ctx, "Watcher error", watchErr)
+		case <-w.renameTimer.C:
+			w.flushRename(ctx)
 		case <-ctx.Done():
 			return
 		}
@@ -140,20 +180,133 @@ func (w *Watcher) processEvent(ctx context.Context, source fsnotify.Event) error
 	}
 
 	event := Event{
-		AbsPath: source.Name,
-		RelPath: relPath,
-		Type:    eventType,
+		AbsPath:    source.Name,
+		RelPath:    relPath,
+		Type:       eventType,
+		OldAbsPath: "",
+		OldRelPath: "",
 	}
 
-	select {
-	case w.events <- event:
-	case <-ctx.Done():
+	switch {
+	case source.Has(fsnotify.Rename):
+		// the new name follows as a create event if it's inside the tree
+		w.holdRename(ctx, event)
 		return nil
+	case source.Has(fsnotify.Remove):
+		w.forget(source.Name)
+	case eventType == EventCreated:
+		id, known := w.record(source.Name)
+		if w.pendingRename == nil {
+			break
+		}
+		if !w.isRenameOf(event, id, known) {
+			// fsnotify doesn't tell which create belongs to the rename, so
+			// another entry is unrelated
+			w.flushRename(ctx)
+			break
+		}
+
+		event.Type = EventRenamed
+		event.OldAbsPath = w.pendingRename.AbsPath
+		event.OldRelPath = w.pendingRename.RelPath
+		w.pendingRename = nil
+		w.pendingID = nil
+		w.renameTimer.Stop()
 	}
 
+	w.emit(ctx, event)
+
 	return nil
 }
 
+func (w *Watcher) holdRename(ctx context.Context, event Event) {
+	if w.pendingRename != nil {
+		if w.pendingRename.AbsPath == event.AbsPath {
+			// renamed directories are reported by both the parent and themselves
+			return
+		}
+		w.flushRename(ctx)
+	}
+
+	w.pendingRename = &event
+	w.pendingID = nil
+	if id, ok := w.ids[event.AbsPath]; ok {
+		w.pendingID = &id
+	}
+	w.forget(event.AbsPath)
+	w.renameTimer.Reset(renameWindow)
+}
+
+// isRenameOf reports whether the created entry is the pending renamed one.
+// Without file identities, e.g. on Windows, only moves which keep the name
+// are paired.
+func (w *Watcher) isRenameOf(created Event, id fileID, known bool) bool {
+	if known && w.pendingID != nil {
+		return id == *w.pendingID
+	}
+
+	return filepath.Base(w.pendingRename.AbsPath) == filepath.Base(created.AbsPath)
+}
+
+// record remembers the identity of the entry.
+func (w *Watcher) record(fullpath string) (fileID, bool) {
+	info, err := os.Lstat(fullpath)
+	if err != nil {
+		return fileID{}, false
+	}
+
+	return w.recordInfo(fullpath, info)
+}
+
+func (w *Watcher) recordInfo(fullpath string, info fs.FileInfo) (fileID, bool) {
+	id, ok := fileIDOf(info)
+	if ok {
+		id.dir = info.IsDir()
+		w.ids[fullpath] = id
+	}
+
+	return id, ok
+}
+
+// forget drops the identity of the entry, and of its content for a
+// directory.
+func (w *Watcher) forget(fullpath string) {
+	id, ok := w.ids[fullpath]
+	delete(w.ids, fullpath)
+	if !ok || !id.dir {
+		return
+	}
+
+	prefix := fullpath + string(filepath.Separator)
+	for p := range w.ids {
+		if strings.HasPrefix(p, prefix) {
+			delete(w.ids, p)
+		}
+	}
+}
+
+// flushRename reports the held entry as removed, it was moved out of the
+// tree or into an excluded path.
+func (w *Watcher) flushRename(ctx context.Context) {
+	if w.pendingRename == nil {
+		return
+	}
+
+	event := *w.pendingRename
+	w.pendingRename = nil
+	w.pendingID = nil
+	w.renameTimer.Stop()
+
+	w.emit(ctx, event)
+}
+
+func (w *Watcher) emit(ctx context.Context, event Event) {
+	select {
+	case w.events <- event:
+	case <-ctx.Done():
+	}
+}
+
 // updateObservers handles fsnotify events for directories.
 // When fsnotify.Remove or fsnotify.Rename event is received, it removes
 // corresponding watcher from the list of watched paths.
@@ -233,6 +386,7 @@ func (w *Watcher) addRecursive(ctx context.Context, path string) error {
 	if err != nil {
 		return fmt.Errorf("fswatcher.Add: %w", err)
 	}
+	w.record(path)
 
 	entries, err := os.ReadDir(path)
 	if err != nil {
@@ -247,6 +401,9 @@ func (w *Watcher) addRecursive(ctx context.Context, path string) error {
 		}
 
 		if !entry.IsDir() {
+			if info, infoErr := entry.Info(); infoErr == nil {
+				w.recordInfo(filepath.Join(path, entry.Name()), info)
+			}
 			continue
 		}
 
@@ -259,6 +416,37 @@ func (w *Watcher) addRecursive(ctx context.Context, path string) error {
 	return nil
 }
 
+// refreshIgnoreFiles reloads the ignore files affected by the event. When
+// the rules change, the directory is walked again to watch subdirectories
+// which are not excluded anymore.
+func (w *Watcher) refreshIgnoreFiles(ctx context.Context, event fsnotify.Event) {
+	if w.matcher == nil || event.Op == fsnotify.Chmod {
+		return
+	}
+	if event.Op == fsnotify.Write && !w.matcher.IsIgnoreFile(event.Name) {
+		return
+	}
+
+	changed, err := w.matcher.Refresh(event.Name)
+	if err != nil {
+		w.logger.Error(ctx, "Failed to reload ignore files", err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	w.logger.Info(ctx, "Ignore rules reloaded", logger.Fields{"path": event.Name})
+
+	dir := filepath.Dir(event.Name)
+	if isDir, _ := w.isDir(event.Name); isDir {
+		dir = event.Name
+	}
+	if addErr := w.addRecursive(ctx, dir); addErr != nil {
+		w.logger.Error(ctx, "Failed to watch directory", addErr)
+	}
+}
+
 func (w *Watcher) isExcluded(ctx context.Context, fullpath string) bool {
 	if w.matcher == nil {
 		return false
@@ -0,0 +1,154 @@
+package watcher_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/capcom6/sftp-sync/internal/watcher"
+	logger "github.com/go-core-fx/cli-logger"
+)
+
+func watch(t *testing.T, root string) watcher.EventsChannel {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	wg := &sync.WaitGroup{}
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	events, err := watcher.New(root, nil, logger.NewDefault()).Watch(ctx, wg)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	return events
+}
+
+// collect returns the events received until none arrive for a while.
+func collect(t *testing.T, events watcher.EventsChannel) []watcher.Event {
+	t.Helper()
+
+	var result []watcher.Event
+	for {
+		select {
+		case event := <-events:
+			result = append(result, event)
+		case <-time.After(500 * time.Millisecond):
+			return result
+		}
+	}
+}
+
+func mkdirs(t *testing.T, paths ...string) {
+	t.Helper()
+
+	for _, p := range paths {
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchReportsMoves(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	mkdirs(t, filepath.Join(root, "a"), filepath.Join(root, "b"))
+	writeFile(t, filepath.Join(root, "a", "x.txt"), "x")
+	events := watch(t, root)
+
+	if err := os.Rename(filepath.Join(root, "a", "x.txt"), filepath.Join(root, "b", "x.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collect(t, events)
+	if len(got) != 1 || got[0].Type != watcher.EventRenamed ||
+		got[0].OldRelPath != filepath.Join("a", "x.txt") || got[0].RelPath != filepath.Join("b", "x.txt") {
+		t.Fatalf("got %+v, want a single rename of a/x.txt to b/x.txt", got)
+	}
+}
+
+func TestWatchReportsRenames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		oldPath string
+		newPath string
+		dir     bool
+	}{
+		{name: "file", oldPath: "a.js", newPath: "b.js", dir: false},
+		{name: "directory", oldPath: "dist", newPath: "dist-old", dir: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			if tt.dir {
+				mkdirs(t, filepath.Join(root, tt.oldPath))
+				writeFile(t, filepath.Join(root, tt.oldPath, "app.js"), "app")
+			} else {
+				writeFile(t, filepath.Join(root, tt.oldPath), "app")
+			}
+			events := watch(t, root)
+
+			if err := os.Rename(filepath.Join(root, tt.oldPath), filepath.Join(root, tt.newPath)); err != nil {
+				t.Fatal(err)
+			}
+
+			got := collect(t, events)
+			if len(got) != 1 || got[0].Type != watcher.EventRenamed ||
+				got[0].OldRelPath != tt.oldPath || got[0].RelPath != tt.newPath {
+				t.Fatalf("got %+v, want a single rename of %s to %s", got, tt.oldPath, tt.newPath)
+			}
+		})
+	}
+}
+
+func TestWatchDoesNotPairUnrelatedEvents(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	outside := t.TempDir()
+	mkdirs(t, filepath.Join(root, "a"), filepath.Join(root, "b"))
+	writeFile(t, filepath.Join(root, "a", "x.txt"), "x")
+	events := watch(t, root)
+
+	// x.txt leaves the tree while another file of the same name is created
+	// right after it
+	if err := os.Rename(filepath.Join(root, "a", "x.txt"), filepath.Join(outside, "x.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "b", "x.txt"), "y")
+
+	removed, created := false, false
+	for _, event := range collect(t, events) {
+		switch {
+		case event.Type == watcher.EventRenamed:
+			t.Fatalf("got %+v, want unrelated events not to be paired", event)
+		case event.Type == watcher.EventRemoved && event.RelPath == filepath.Join("a", "x.txt"):
+			removed = true
+		case event.Type == watcher.EventCreated && event.RelPath == filepath.Join("b", "x.txt"):
+			created = true
+		}
+	}
+	if !removed || !created {
+		t.Fatalf("got removed %v, created %v, want both", removed, created)
+	}
+}
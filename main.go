@@ -9,7 +9,12 @@ import (
 	"syscall"
 
 	"github.com/capcom6/sftp-sync/internal/cli/codes"
+	"github.com/capcom6/sftp-sync/internal/cli/commands/deletions"
+	"github.com/capcom6/sftp-sync/internal/cli/commands/push"
+	"github.com/capcom6/sftp-sync/internal/cli/commands/queue"
+	"github.com/capcom6/sftp-sync/internal/cli/commands/restore"
 	"github.com/capcom6/sftp-sync/internal/cli/commands/sync"
+	"github.com/capcom6/sftp-sync/internal/cli/flags"
 	logger "github.com/go-core-fx/cli-logger"
 	"github.com/joho/godotenv"
 	"github.com/samber/lo"
@@ -58,43 +63,35 @@ func main() {
 		Version:   appVersion,
 		ArgsUsage: "[source]",
 		Arguments: []cli.Argument{
-			&cli.StringArg{
-				Name:      "source",
-				UsageText: "local directory to watch for changes",
-				Config: cli.StringConfig{
-					TrimSpace: true,
-				},
-			},
+			flags.Source("local directory to watch for changes"),
 		},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.BoolFlag{
 				Name:    "debug",
 				Usage:   "enable debug mode",
 				Sources: cli.EnvVars("DEBUG"),
 			},
-
-			&cli.StringFlag{
-				Name:     "dest",
-				Usage:    "destination FTP server URL",
-				Required: true,
-			},
-			&cli.StringSliceFlag{
-				Name:  "exclude",
-				Usage: "paths or glob patterns to exclude (supports *, **, ?)",
-			},
-			&cli.BoolFlag{
-				Name:  "dry-run",
-				Usage: "perform a dry run without actually syncing files",
-			},
-		},
+		}, flags.Local(sync.Flags())...),
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			if cmd.Bool("debug") {
 				log.SetLevel(logger.LogLevelDebug)
 			}
 
+			// the root command works as the sync command unless a subcommand
+			// is requested
+			if cmd.Command(cmd.Args().First()) != nil {
+				return ctx, nil
+			}
+
 			return sync.Before(ctx, cmd)
 		},
 		Action: sync.Action,
+		Commands: []*cli.Command{
+			push.Command(),
+			deletions.Command(),
+			queue.Command(),
+			restore.Command(),
+		},
 		Authors: []any{
 			"Aleksandr Soloshenko <i@capcom.me>",
 		},